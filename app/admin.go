@@ -0,0 +1,75 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/alpha-omega-corp/core/httputils"
+	"github.com/uptrace/bunrouter"
+	"net/http"
+)
+
+type ConfigStatus struct {
+	Name     string `json:"name"`
+	Revision int64  `json:"revision"`
+}
+
+// RegisterAdminRoutes exposes operational information about the running
+// service.
+func RegisterAdminRoutes(configHandler *ConfigHandler, g *Group) {
+	g.GET("/admin/config", func(w http.ResponseWriter, req bunrouter.Request) error {
+		return bunrouter.JSON(w, ConfigStatus{
+			Name:     configHandler.name,
+			Revision: configHandler.GetConfig().Revision(),
+		})
+	})
+}
+
+// RegisterFlagRoutes lets operators list, set and delete feature flags.
+func RegisterFlagRoutes(store *FlagStore, g *Group) {
+	available := func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			if store == nil {
+				httputils.Error(w, errors.New("feature flags unavailable"), http.StatusServiceUnavailable)
+				return nil
+			}
+
+			return next(w, req)
+		}
+	}
+
+	g.Use(available).WithGroup("/admin/flags", func(g *Group) {
+		g.GET("", func(w http.ResponseWriter, req bunrouter.Request) error {
+			return bunrouter.JSON(w, store.List())
+		})
+
+		g.PUT("/:name", func(w http.ResponseWriter, req bunrouter.Request) error {
+			var flag Flag
+			if err := json.NewDecoder(req.Body).Decode(&flag); err != nil {
+				httputils.Error(w, err, http.StatusBadRequest)
+				return nil
+			}
+			flag.Name = req.Param("name")
+
+			if err := flag.Validate(); err != nil {
+				httputils.Error(w, err, http.StatusBadRequest)
+				return nil
+			}
+
+			if err := store.Set(req.Context(), flag); err != nil {
+				return err
+			}
+
+			return bunrouter.JSON(w, flag)
+		})
+
+		g.DELETE("/:name", func(w http.ResponseWriter, req bunrouter.Request) error {
+			if err := store.Delete(req.Context(), req.Param("name")); err != nil {
+				httputils.Error(w, err, http.StatusNotFound)
+				return nil
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		})
+	})
+}
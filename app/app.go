@@ -7,39 +7,97 @@ import (
 	"github.com/alpha-omega-corp/core/app/models"
 	"github.com/alpha-omega-corp/core/app/proto"
 	"github.com/uptrace/bun"
-	"github.com/uptrace/bun/dbfixture"
 	"github.com/uptrace/bun/migrate"
 	"github.com/uptrace/bunrouter"
-	"github.com/uptrace/bunrouter/extra/bunrouterotel"
 	"github.com/urfave/cli/v3"
 	"google.golang.org/grpc"
 	"log"
+	"log/slog"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 )
 
 type App struct {
 	name          string
+	env           string
 	dbHandler     *StorageHandler
 	configHandler *ConfigHandler
 	models        []any
+	newSettings   func() any
+	migrations    *migrate.Migrations
+	authTables    bool
+	flags         *FlagStore
+	lifecycle     *Lifecycle
+	signal        os.Signal
 
 	fs embed.FS
 }
 
 func NewApp(efs embed.FS, name string) *App {
 	return &App{
-		name: name,
-		fs:   efs,
+		name:       name,
+		fs:         efs,
+		migrations: migrate.NewMigrations(migrate.WithMigrationsDirectory(migrationsDir)),
+		lifecycle:  NewLifecycle(),
 	}
 }
 
+func (app *App) Storage() *StorageHandler {
+	return app.dbHandler
+}
+
+func (app *App) Lifecycle() *Lifecycle {
+	return app.lifecycle
+}
+
+// OnShutdown registers fn to run once the servers have stopped, before the
+// database and etcd clients are closed.
+func (app *App) OnShutdown(fn func(ctx context.Context) error) {
+	app.lifecycle.OnShutdown(fn)
+}
+
+// AddHealthCheck registers a readiness check reported by /readyz and the
+// gRPC health service.
+func (app *App) AddHealthCheck(name string, check HealthCheck) {
+	app.lifecycle.Health().AddCheck(name, check)
+}
+
+// Flags is the feature flag cache of a running server, nil when etcd was not
+// reachable at startup.
+func (app *App) Flags() *FlagStore {
+	return app.flags
+}
+
+// CreateApi runs the gateway command line. It returns the signal that stopped
+// the server, or nil for other commands. The routes init registers on the
+// bunrouter router are only listed in the catalog and the OpenAPI document
+// once they have been served; register them with CreateApiWithRouter to list
+// them from the start.
 func (app *App) CreateApi(init func(configHandler *ConfigHandler, router *bunrouter.Router)) os.Signal {
+	return app.CreateApiWithRouter(func(configHandler *ConfigHandler, router *Router) {
+		init(configHandler, router.Bunrouter())
+	})
+}
+
+// CreateApiWithRouter is CreateApi with a Router, which records the routes
+// registered through it.
+func (app *App) CreateApiWithRouter(init func(configHandler *ConfigHandler, router *Router)) os.Signal {
+	app.models = append(app.models, []interface{}{
+		(*models.UserToRole)(nil),
+		(*models.User)(nil),
+		(*models.Role)(nil),
+		(*models.Service)(nil),
+		(*models.Permission)(nil),
+	}...)
+	app.authTables = true
+
 	appCli := &cli.Command{
 		Usage: "cloud application cli",
 		Commands: []*cli.Command{
 			app.newHttpCommand(init),
+			app.dbCommand(),
+			app.configCommand(),
+			app.flagsCommand(),
 		},
 	}
 
@@ -47,16 +105,7 @@ func (app *App) CreateApi(init func(configHandler *ConfigHandler, router *bunrou
 		log.Fatalf("app start error: %v\n", err)
 	}
 
-	// Create keyboard listener
-	ch := make(chan os.Signal, 3)
-	signal.Notify(
-		ch,
-		syscall.SIGINT,
-		syscall.SIGQUIT,
-		syscall.SIGTERM,
-	)
-
-	return <-ch
+	return app.signal
 }
 
 func (app *App) CreateApp(init func(config *Config, db *bun.DB, grpc *grpc.Server), models ...any) {
@@ -66,7 +115,9 @@ func (app *App) CreateApp(init func(config *Config, db *bun.DB, grpc *grpc.Serve
 		Usage: "cloud application cli",
 		Commands: []*cli.Command{
 			app.newGrpcCommand(init),
-			app.migrateCommand(),
+			app.dbCommand(),
+			app.configCommand(),
+			app.flagsCommand(),
 		},
 	}
 
@@ -75,128 +126,210 @@ func (app *App) CreateApp(init func(config *Config, db *bun.DB, grpc *grpc.Serve
 	}
 }
 
+// CreateAppWithConfig is CreateApp with the configuration also decoded into a
+// T, whose `validate` tags are checked along with the base Config at startup
+// and on every reload. init gets the settings at startup; Settings returns
+// the current ones from ConfigHandler.GetConfig.
+func CreateAppWithConfig[T any](app *App, init func(settings *T, config *Config, db *bun.DB, grpc *grpc.Server), models ...any) {
+	app.newSettings = func() any {
+		return new(T)
+	}
+
+	app.CreateApp(func(config *Config, db *bun.DB, grpc *grpc.Server) {
+		init(Settings[T](config), config, db, grpc)
+	}, models...)
+}
+
 func (app *App) newGrpcCommand(init func(config *Config, db *bun.DB, grpc *grpc.Server)) *cli.Command {
 	return app.createCommand("app", "server", func(ctx context.Context, cmd *cli.Command) {
-		if err := GRPC(*app.configHandler, app.dbHandler, func(db *bun.DB, grpc *grpc.Server) {
-			init(app.configHandler.config, db, grpc)
-		}); err != nil {
-			panic(err)
-		}
+		app.loadFlags(ctx)
+
+		app.lifecycle.Go("grpc server", func() error {
+			return GRPC(app.lifecycle, app.configHandler, app.dbHandler, func(db *bun.DB, grpc *grpc.Server) {
+				init(app.configHandler.GetConfig(), db, grpc)
+			})
+		})
+
+		app.signal = app.lifecycle.Wait()
 	})
 }
 
-func (app *App) newHttpCommand(init func(configHandler *ConfigHandler, router *bunrouter.Router)) *cli.Command {
+func (app *App) newHttpCommand(init func(configHandler *ConfigHandler, router *Router)) *cli.Command {
 	return app.createCommand("app", "server", func(ctx context.Context, cmd *cli.Command) {
+		userConfig, err := app.configHandler.requestConfig("user")
+		if err != nil {
+			log.Fatalf("user service configuration error: %v", err)
+		}
+		userConfigHandler := newStaticConfigHandler("user", userConfig, app.configHandler.etcd)
 
-		app.models = append(app.models, []interface{}{
-			(*models.UserToRole)(nil),
-			(*models.User)(nil),
-			(*models.Role)(nil),
-			(*models.Service)(nil),
-			(*models.Permission)(nil),
-		}...)
+		fmt.Println(app.configHandler.GetConfig().Url)
 
-		env := cmd.String("env")
-		app.loadConfig(env, app.name)
+		services := make(chan []string, 1)
+		app.lifecycle.Go("user grpc server", func() error {
+			return GRPC(app.lifecycle, userConfigHandler, app.dbHandler, func(db *bun.DB, grpc *grpc.Server) {
+				auth := NewAuthWrapper(userConfigHandler.GetConfig().Env.GetString("secret"))
+				proto.RegisterAuthServiceServer(grpc, NewAuthServer(db, auth))
+				services <- serviceNames(grpc)
+			})
+		})
 
-		if app.configHandler.config.Dsn != nil {
-			app.dbHandler = NewStorageHandler(*app.configHandler.config.Dsn)
-			app.dbHandler.Database().RegisterModel(app.models...)
-		}
+		fmt.Print(*app.configHandler.GetConfig().Url)
 
-		userURL := app.configHandler.config.Env.GetString("user_url")
-		userDSN := app.configHandler.config.Env.GetString("user_dsn")
+		app.loadFlags(ctx)
+		userConn, err := app.userConn(userConfigHandler)
+		if err != nil {
+			log.Fatalf("user client error: %v", err)
+		}
+		authService := proto.NewAuthServiceClient(userConn)
+		app.lifecycle.Health().AddDependency("user", GRPCHealthCheck(userConn, ""))
 
-		userConfigHandler := &ConfigHandler{
-			name: "user",
-			config: &Config{
-				Url: &userURL,
-				Dsn: &userDSN,
-				Env: app.configHandler.config.Env,
-			},
+		middlewares := []bunrouter.MiddlewareFunc{
+			NewCorsMiddleware(app.configHandler),
+			NewRateLimitMiddleware(app.configHandler),
+			NewFlagsMiddleware(app.flags, authService),
 		}
 
-		fmt.Println(app.configHandler.config.Url)
-		*userConfigHandler.config.Dsn = userConfigHandler.config.Env.GetString("user_dsn")
+		HTTP(app.lifecycle, app.configHandler, func(r *Router) {
+			var names []string
+			select {
+			case names = <-services:
+			case <-app.lifecycle.stop:
+				return
+			}
 
-		go func() {
-			if err := GRPC(*userConfigHandler, app.dbHandler, func(db *bun.DB, grpc *grpc.Server) {
-				auth := NewAuthWrapper(userConfigHandler.config.Env.GetString("user_secret"))
-				proto.RegisterAuthServiceServer(grpc, NewAuthServer(db, auth))
-			}); err != nil {
-				panic(err)
+			// Register the gateway of the user services, login, register and
+			// validate are public. Creating and deleting users requires
+			// user.write, changing roles and permissions, which UpdateUser
+			// also does, user.manage.
+			gateway := []GatewayOption{
+				GatewayAuth(NewAuthMiddleware(authService).Auth, "auth.AuthService.Login", "auth.AuthService.Register", "auth.AuthService.Validate"),
+				GatewayBearerToken("auth.AuthService.Validate", "token"),
+				GatewayPermission(authService, "user.write", "auth.AuthService.CreateUser", "auth.AuthService.DeleteUser"),
+				GatewayPermission(authService, "user.manage", "auth.AuthService.UpdateUser", "auth.AuthService.AssignRole", "auth.AuthService.CreateRole", "auth.AuthService.CreateServicePermissions"),
+			}
+			for _, name := range names {
+				if err := RegisterGateway(r.Group, userConn, name, gateway...); err != nil {
+					log.Fatalf("user gateway error: %v", err)
+				}
 			}
-		}()
 
-		fmt.Print(*app.configHandler.config.Url)
+			manage := strings.ToLower(app.name) + ".manage"
+			admin := r.Use(NewPermissionMiddleware(authService, manage))
+			RegisterAdminRoutes(app.configHandler, admin)
+			RegisterFlagRoutes(app.flags, admin)
+			RegisterCatalogRoutes(app.lifecycle.Catalog(), admin)
 
-		HTTP(*app.configHandler, func(r *bunrouter.Router) {
-			r.Use(bunrouterotel.NewMiddleware())
-			r.Use(NewCorsMiddleware())
+			config := app.configHandler.GetConfig()
+			api := NewOpenAPI(app.name, config.Env.GetString("openapi.version"))
+			for _, name := range names {
+				api.AddService(name, gateway...)
+			}
+			api.Secure("/admin", manage)
 
-			// Register user client
-			userClient := RegisterAuthClient(NewAuthClient(NewClient(userConfigHandler.config, proto.NewAuthServiceClient)), r)
-			r.Use(NewAuthMiddleware(userClient).Auth)
+			var ui *Redoc
+			if config.Env.GetBool("openapi.ui") && !IsProduction(app.env) {
+				ui = &Redoc{Bundle: config.Env.GetString("openapi.redoc_bundle"), Integrity: config.Env.GetString("openapi.redoc_integrity")}
+			}
+			if err := RegisterOpenAPIRoutes(api, r, ui); err != nil {
+				log.Fatalf("openapi error: %v", err)
+			}
 
 			init(app.configHandler, r)
-		})
+		}, middlewares...)
 
+		app.signal = app.lifecycle.Wait()
 	})
 }
 
-func (app *App) migrateCommand() *cli.Command {
-	return app.createCommand("db", "migration", func(ctx context.Context, cmd *cli.Command) {
-		db := app.dbHandler.Database()
-
-		migrator := migrate.NewMigrator(db, migrate.NewMigrations())
-		if err := migrator.Init(ctx); err != nil {
-			panic(err)
-		}
-		if err := db.ResetModel(ctx, app.models...); err != nil {
-			panic(err)
-		}
+// userConn connects to the user service through the registry, or straight to
+// the instance this process runs when etcd is not connected.
+func (app *App) userConn(userConfigHandler *ConfigHandler) (*grpc.ClientConn, error) {
+	if app.configHandler.etcd == nil && app.configHandler.GetConfig().Env.GetString("services.user") == "" {
+		return dialService(app.configHandler.GetConfig(), "passthrough:///"+*userConfigHandler.GetConfig().Url)
+	}
 
-		fixture := dbfixture.New(db)
-		if err := fixture.Load(ctx, os.DirFS("cmd/fixtures"), "fixture.yml"); err != nil {
-			fmt.Printf("load fixture error: %v\n", err)
-			panic(err)
-		}
-	})
+	return newClientConn(app.configHandler, "user")
 }
 
-func (app *App) loadConfig(env string, name string) {
-	configFile, err := app.fs.ReadFile(GetConfigPath(env))
+func (app *App) loadConfig(env string, name string, opts ...ConfigOption) {
+	configFile, err := readConfigFile(app.fs, env)
 	if err != nil {
 		log.Fatalf("read config file error: %v\n", err)
 	}
 
-	app.configHandler = NewConfigHandler(context.Background(), name, configFile)
+	if app.newSettings != nil {
+		opts = append(opts, withSettings(app.newSettings))
+	}
+
+	app.configHandler = NewConfigHandler(context.Background(), name, configFile, opts...)
+	if err := validateConfig(app.configHandler.GetConfig()); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+
+	app.configHandler.watchLogLevel()
+}
+
+func (app *App) loadFlags(ctx context.Context) {
+	if app.configHandler.etcd == nil {
+		return
+	}
+
+	flags, err := NewFlagStore(ctx, app.configHandler.etcd)
+	if err != nil {
+		slog.Warn("feature flags unavailable", "error", err)
+		return
+	}
+
+	app.flags = flags
 }
 
-func (app *App) createCommand(category string, name string, action func(ctx context.Context, cmd *cli.Command)) *cli.Command {
+func (app *App) createCommand(category string, name string, action func(ctx context.Context, cmd *cli.Command), flags ...cli.Flag) *cli.Command {
 	return &cli.Command{
 		Name:     name,
 		Category: category,
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:    "env",
-				Aliases: []string{"e"},
-				Value:   "local",
-				Usage:   "environment to select configuration file",
-			},
-		},
+		Flags:    append(configFlags(), flags...),
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			env := cmd.String("env")
-			app.loadConfig(env, app.name)
+			app.env = env
+			app.loadConfig(env, app.name, WithOverrides(cmd.StringSlice("set")))
+			if etcd := app.configHandler.etcd; etcd != nil {
+				app.lifecycle.OnClose(etcd.Close)
+				app.lifecycle.Health().AddOptionalCheck("etcd", app.configHandler.Ping)
+			}
 
-			if app.configHandler.config.Dsn != nil {
-				app.dbHandler = NewStorageHandler(*app.configHandler.config.Dsn)
+			config := app.configHandler.GetConfig()
+			if config.Dsn != nil && *config.Dsn != "" {
+				app.dbHandler = NewStorageHandler(*config.Dsn, config.Db)
 				app.dbHandler.Database().RegisterModel(app.models...)
+				app.lifecycle.OnClose(app.dbHandler.Close)
+				app.lifecycle.Health().AddCheck("postgres", app.dbHandler.Ping)
 			}
 
 			action(ctx, cmd)
 
+			config = app.configHandler.GetConfig()
+			app.lifecycle.SetShutdownDelay(config.Env.GetDuration("shutdown_delay"))
+			if err := app.lifecycle.Shutdown(config.Env.GetDuration("shutdown_timeout")); err != nil {
+				slog.Error("shutdown error", "error", err)
+			}
+
 			return nil
 		},
 	}
 }
+
+func configFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "env",
+			Aliases: []string{"e"},
+			Value:   "local",
+			Usage:   "environment to select configuration file (config/config.<env>.yml)",
+			Sources: cli.EnvVars(envEnv),
+		},
+		&cli.StringSliceFlag{
+			Name:  "set",
+			Usage: "override a configuration key (key=value), takes precedence over every other source",
+		},
+	}
+}
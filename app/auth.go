@@ -6,31 +6,12 @@ import (
 	"fmt"
 	"github.com/alpha-omega-corp/core/app/models"
 	"github.com/alpha-omega-corp/core/app/proto"
-	"github.com/alpha-omega-corp/core/httputils"
 	"github.com/uptrace/bun"
-	"github.com/uptrace/bunrouter"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"net/http"
 	"strings"
 )
 
-type AuthClient interface {
-	Login(w http.ResponseWriter, req bunrouter.Request) error
-	Validate(w http.ResponseWriter, req bunrouter.Request) error
-	Register(w http.ResponseWriter, req bunrouter.Request) error
-	GetUsers(w http.ResponseWriter, req bunrouter.Request) error
-	CreateUser(w http.ResponseWriter, req bunrouter.Request) error
-	UpdateUser(w http.ResponseWriter, req bunrouter.Request) error
-	DeleteUser(w http.ResponseWriter, req bunrouter.Request) error
-	AssignUser(w http.ResponseWriter, req bunrouter.Request) error
-	GetUserPermissions(w http.ResponseWriter, req bunrouter.Request) error
-	GetRoles(w http.ResponseWriter, req bunrouter.Request) error
-	CreateRole(w http.ResponseWriter, req bunrouter.Request) error
-	GetServices(w http.ResponseWriter, req bunrouter.Request) error
-	GetServicePermissions(w http.ResponseWriter, req bunrouter.Request) error
-	CreateServicePermissions(w http.ResponseWriter, req bunrouter.Request) error
-}
-
 type AuthServer struct {
 	proto.UnimplementedAuthServiceServer
 
@@ -45,140 +26,6 @@ func NewAuthServer(db *bun.DB, aw *AuthWrapper) *AuthServer {
 	}
 }
 
-func RegisterAuthClient(client AuthClient, r *bunrouter.Router) AuthClient {
-	r.GET("/users", client.GetUsers)
-	r.POST("/users", client.CreateUser)
-	r.PUT("/users/:id", client.UpdateUser)
-	r.DELETE("/users/:id", client.DeleteUser)
-	r.POST("/users/roles", client.AssignUser)
-	r.GET("/users/:id/permissions", client.GetUserPermissions)
-	r.GET("/auth/roles", client.GetRoles)
-	r.POST("/auth/roles", client.CreateRole)
-	r.GET("/auth/services", client.GetServices)
-	r.GET("/auth/services/:id/permissions", client.GetServicePermissions)
-	r.POST("/auth/services/permissions", client.CreateServicePermissions)
-	r.POST("/auth/login", client.Login)
-	r.POST("/auth/register", client.Register)
-	r.POST("/auth/validate", client.Validate)
-
-	return client
-}
-
-type authClient struct {
-	AuthClient
-	service proto.AuthServiceClient
-}
-
-func NewAuthClient(client proto.AuthServiceClient) AuthClient {
-	return &authClient{service: client}
-}
-
-func (c *authClient) Login(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.LoginResponse, error) {
-		data := httputils.GetBody[proto.LoginRequest](w, req)
-
-		return c.service.Login(req.Context(), data)
-	})
-}
-
-func (c *authClient) Validate(w http.ResponseWriter, req bunrouter.Request) error {
-	authHeader := req.Header.Get("Authorization")
-	token := strings.Split(authHeader, "Bearer ")[1]
-
-	return httputils.Response(w, func() (*proto.ValidateResponse, error) {
-		return c.service.Validate(req.Context(), &proto.ValidateRequest{
-			Token: token,
-		})
-	})
-}
-
-func (c *authClient) Register(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.RegisterResponse, error) {
-		data := httputils.GetBody[proto.RegisterRequest](w, req)
-
-		return c.service.Register(req.Context(), data)
-	})
-}
-
-func (c *authClient) GetUsers(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response[proto.GetUsersResponse](w, func() (*proto.GetUsersResponse, error) {
-		return c.service.GetUsers(req.Context(), &emptypb.Empty{})
-	})
-}
-
-func (c *authClient) GetRoles(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.GetRolesResponse, error) {
-		return c.service.GetRoles(req.Context(), &emptypb.Empty{})
-	})
-}
-
-func (c *authClient) GetServices(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.GetServicesResponse, error) {
-		return c.service.GetServices(req.Context(), &emptypb.Empty{})
-	})
-}
-
-func (c *authClient) CreateUser(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.CreateUserResponse, error) {
-		data := httputils.GetBody[proto.CreateUserRequest](w, req)
-
-		return c.service.CreateUser(req.Context(), data)
-	})
-}
-func (c *authClient) UpdateUser(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.UpdateUserResponse, error) {
-		data := httputils.GetBody[proto.UpdateUserRequest](w, req)
-
-		return c.service.UpdateUser(req.Context(), data)
-	})
-}
-
-func (c *authClient) DeleteUser(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.DeleteUserResponse, error) {
-		data := httputils.GetBody[proto.DeleteUserRequest](w, req)
-		return c.service.DeleteUser(req.Context(), data)
-	})
-}
-
-func (c *authClient) CreateRole(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.CreateRoleResponse, error) {
-		data := httputils.GetBody[proto.CreateRoleRequest](w, req)
-		return c.service.CreateRole(req.Context(), data)
-	})
-}
-
-func (c *authClient) AssignUser(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.AssignRoleResponse, error) {
-		data := httputils.GetBody[proto.AssignRoleRequest](w, req)
-
-		return c.service.AssignRole(req.Context(), data)
-	})
-}
-
-func (c *authClient) CreatePermission(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.CreateServicePermissionsResponse, error) {
-		data := httputils.GetBody[proto.CreateServicePermissionsRequest](w, req)
-
-		return c.service.CreateServicePermissions(req.Context(), data)
-	})
-}
-
-func (c *authClient) GetUserPermissions(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.GetUserPermissionsResponse, error) {
-		data := httputils.GetBody[proto.GetUserPermissionsRequest](w, req)
-
-		return c.service.GetUserPermissions(req.Context(), data)
-	})
-}
-
-func (c *authClient) GetServicePermissions(w http.ResponseWriter, req bunrouter.Request) error {
-	return httputils.Response(w, func() (*proto.GetServicePermissionsResponse, error) {
-		data := httputils.GetParams[proto.GetServicePermissionsRequest](w, req)
-
-		return c.service.GetServicePermissions(req.Context(), data)
-	})
-}
-
 func (s *AuthServer) GetUser(ctx context.Context, req *proto.GetUserRequest) (*proto.GetUserResponse, error) {
 	user := new(models.User)
 
@@ -538,15 +385,24 @@ func (s *AuthServer) Validate(ctx context.Context, req *proto.ValidateRequest) (
 	}
 
 	var user models.User
-	err = s.db.NewSelect().Model(&user).Where("email = ?", claims.Email).Scan(ctx, &user)
+	err = s.db.NewSelect().Model(&user).Relation("Roles").Where("email = ?", claims.Email).Scan(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	roles := make([]*proto.Role, len(user.Roles))
+	for index, role := range user.Roles {
+		roles[index] = &proto.Role{
+			Id:   role.Id,
+			Name: role.Name,
+		}
+	}
+
 	return &proto.ValidateResponse{
 		User: &proto.User{
 			Id:    user.Id,
 			Email: user.Email,
+			Roles: roles,
 		},
 	}, nil
 }
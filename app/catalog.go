@@ -0,0 +1,88 @@
+package app
+
+import (
+	"github.com/uptrace/bunrouter"
+	"google.golang.org/grpc"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Catalog lists the gRPC services and HTTP routes served by the process.
+type Catalog struct {
+	mu      sync.Mutex
+	servers []*grpc.Server
+	routers []*Router
+}
+
+type ServiceCatalog struct {
+	GRPC []GRPCService `json:"grpc"`
+	HTTP []HTTPRoute   `json:"http"`
+}
+
+type GRPCService struct {
+	Name    string   `json:"name"`
+	Methods []string `json:"methods"`
+}
+
+type HTTPRoute struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+func (c *Catalog) addGRPC(srv *grpc.Server) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.servers = append(c.servers, srv)
+}
+
+func (c *Catalog) addRouter(r *Router) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.routers = append(c.routers, r)
+}
+
+func (c *Catalog) Services() ServiceCatalog {
+	c.mu.Lock()
+	servers := append([]*grpc.Server(nil), c.servers...)
+	routers := append([]*Router(nil), c.routers...)
+	c.mu.Unlock()
+
+	catalog := ServiceCatalog{GRPC: []GRPCService{}, HTTP: []HTTPRoute{}}
+
+	for _, srv := range servers {
+		for name, info := range srv.GetServiceInfo() {
+			service := GRPCService{Name: name}
+			for _, method := range info.Methods {
+				service.Methods = append(service.Methods, method.Name)
+			}
+			sort.Strings(service.Methods)
+
+			catalog.GRPC = append(catalog.GRPC, service)
+		}
+	}
+	sort.Slice(catalog.GRPC, func(i, j int) bool {
+		return catalog.GRPC[i].Name < catalog.GRPC[j].Name
+	})
+
+	for _, r := range routers {
+		catalog.HTTP = append(catalog.HTTP, r.Routes()...)
+	}
+	sort.Slice(catalog.HTTP, func(i, j int) bool {
+		if catalog.HTTP[i].Path != catalog.HTTP[j].Path {
+			return catalog.HTTP[i].Path < catalog.HTTP[j].Path
+		}
+		return catalog.HTTP[i].Method < catalog.HTTP[j].Method
+	})
+
+	return catalog
+}
+
+// RegisterCatalogRoutes exposes the catalog of the running process.
+func RegisterCatalogRoutes(catalog *Catalog, g *Group) {
+	g.GET("/admin/catalog", func(w http.ResponseWriter, req bunrouter.Request) error {
+		return bunrouter.JSON(w, catalog.Services())
+	})
+}
@@ -1,50 +1,164 @@
 package app
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/spf13/viper"
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc/connectivity"
 	"log"
+	"log/slog"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var Environment = map[string]string{
-	"local":  "local",
-	"docker": "docker",
+type Config struct {
+	Url  *string       `mapstructure:"url" validate:"required,hostport"`
+	Dsn  *string       `mapstructure:"dsn" validate:"omitempty,dsn"`
+	Db   StorageConfig `mapstructure:"db"`
+	Grpc GRPCConfig    `mapstructure:"grpc"`
+	Cors CorsConfig    `mapstructure:"cors"`
+	Env  *viper.Viper  `mapstructure:"-"`
+
+	settings any
+	layers   []ConfigLayer
+	secrets  map[string]bool
+	remote   []byte
+	revision int64
 }
 
-func GetConfigPath(env string) string {
-	path := "config/config." + Environment[env] + ".yml"
+type ConfigHandler struct {
+	name   string
+	etcd   *clientv3.Client
+	config atomic.Pointer[Config]
+
+	file        []byte
+	defaults    map[string]any
+	overrides   []string
+	newSettings func() any
 
-	return path
+	mu          sync.Mutex
+	listeners   []configListener
+	importNames []string
+	imports     map[string][]byte
+
+	applying sync.Mutex
 }
 
-type Config struct {
-	Url *string `mapstruct:"url"`
-	Dsn *string `mapstruct:"dsn"`
-	Env *viper.Viper
+type configListener struct {
+	key string
+	fn  func(config *Config)
 }
 
-type ConfigHandler struct {
-	name   string
-	viper  *viper.Viper
-	etcd   *clientv3.Client
-	config *Config
+const (
+	ConfigModeSeed     = "seed"
+	ConfigModePush     = "push"
+	ConfigModeReadOnly = "read-only"
+)
+
+func NewConfigHandler(ctx context.Context, name string, file []byte, opts ...ConfigOption) *ConfigHandler {
+	handler, err := newConfigClient(name, file, opts...)
+	if handler == nil {
+		log.Fatalf("config error: %v", err)
+	}
+
+	if err := handler.start(ctx, err); err != nil {
+		log.Fatalf("config error: %v", err)
+	}
+
+	return handler
+}
+
+// start loads the configuration from etcd and follows its changes. When etcd
+// cannot be reached (err) or the configuration cannot be loaded from it,
+// start falls back to the local configuration if config_fallback is set.
+func (h *ConfigHandler) start(ctx context.Context, err error) error {
+	if err == nil {
+		err = h.connect(ctx)
+	}
+
+	if err != nil {
+		if !h.GetConfig().Env.GetBool("config_fallback") {
+			return err
+		}
+
+		h.startOffline(ctx, err)
+		return nil
+	}
+
+	go h.watch(ctx)
+	h.watchImports(ctx)
+
+	return nil
+}
+
+// newConfigClient resolves every source but etcd and connects to the etcd
+// endpoint found in the result. The handler is returned alongside a
+// connection error so callers can fall back to the local configuration.
+func newConfigClient(name string, file []byte, opts ...ConfigOption) (*ConfigHandler, error) {
+	handler := &ConfigHandler{
+		name:     name,
+		file:     file,
+		defaults: make(map[string]any, len(DefaultSettings)),
+	}
+
+	for key, value := range DefaultSettings {
+		handler.defaults[key] = value
+	}
+
+	for _, opt := range opts {
+		opt(handler)
+	}
+
+	local, err := handler.resolve(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	handler.config.Store(local)
+
+	handler.etcd, err = newEtcdClient(local.Env)
+	if err != nil {
+		return handler, err
+	}
+
+	return handler, nil
 }
 
-func NewConfigHandler(ctx context.Context, name string, file []byte) *ConfigHandler {
-	v := viper.New()
+// connect reconciles the embedded file with etcd and loads the stored
+// configuration.
+func (h *ConfigHandler) connect(ctx context.Context) error {
+	if err := syncConfig(ctx, h.etcd, h.name, h.file, h.GetConfig().Env.GetString("config_mode")); err != nil {
+		return err
+	}
+
+	kv, err := getRemoteValue(ctx, h.etcd, h.name, 0)
+	if err != nil {
+		return err
+	}
+
+	if err := h.loadImports(ctx, kv.Value); err != nil {
+		return err
+	}
 
-	v.SetConfigType("yaml")
-	err := v.ReadConfig(bytes.NewBuffer(file))
+	c, err := h.resolve(kv.Value)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
+	c.revision = kv.ModRevision
+	h.config.Store(c)
+	h.saveCache(h.name, kv.Value)
+	fmt.Printf("config loaded > %s (revision %d)\n", h.name, kv.ModRevision)
+
+	return nil
+}
+
+func newEtcdClient(v *viper.Viper) (*clientv3.Client, error) {
 	host := v.GetString("kvs")
 	fmt.Printf("config host > %s\n", host)
 
@@ -55,97 +169,307 @@ func NewConfigHandler(ctx context.Context, name string, file []byte) *ConfigHand
 
 	etcd, err := clientv3.New(config)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	cancelCtx, cancel := context.WithTimeout(context.Background(), config.DialTimeout)
+	if err := waitEtcd(context.Background(), etcd, config.DialTimeout); err != nil {
+		return etcd, err
+	}
+
+	fmt.Printf("etcd > %s\n", etcd.ActiveConnection().GetState())
+
+	return etcd, nil
+}
+
+func waitEtcd(ctx context.Context, etcd *clientv3.Client, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	select {
-	case <-cancelCtx.Done():
-		if etcd.ActiveConnection().GetState() != connectivity.Ready {
-			log.Fatalf("etcd connection timeout")
+	conn := etcd.ActiveConnection()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
 		}
-	}
 
-	fmt.Printf("etcd > %s\n", etcd.ActiveConnection().GetState())
+		if state == connectivity.Idle {
+			conn.Connect()
+		}
 
-	_, err = etcd.Put(ctx, "config_"+name, string(file))
-	if err != nil {
-		panic(err)
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("etcd connection timeout (%s)", state)
+		}
 	}
+}
 
-	handler := &ConfigHandler{
-		etcd:  etcd,
-		viper: viper.New(),
-	}
+// syncConfig reconciles the embedded file with etcd according to mode: seed
+// only writes when the key is absent, push always overwrites and read-only
+// never writes.
+func syncConfig(ctx context.Context, etcd *clientv3.Client, name string, file []byte, mode string) error {
+	key := configKey(name)
+
+	switch mode {
+	case "", ConfigModeSeed:
+		res, err := etcd.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, string(file))).
+			Commit()
+		if err != nil {
+			return err
+		}
 
-	c, err := handler.requestConfig(name)
-	if err != nil {
-		panic(err)
+		if res.Succeeded {
+			fmt.Printf("config seeded > %s\n", key)
+		}
+	case ConfigModePush:
+		if _, err := etcd.Put(ctx, key, string(file)); err != nil {
+			return err
+		}
+
+		fmt.Printf("config pushed > %s\n", key)
+	case ConfigModeReadOnly:
+	default:
+		return fmt.Errorf("unknown config mode %q, expected %s, %s or %s", mode, ConfigModeSeed, ConfigModePush, ConfigModeReadOnly)
 	}
 
-	handler.config = c
+	return nil
+}
+
+func newStaticConfigHandler(name string, config *Config, etcd *clientv3.Client) *ConfigHandler {
+	handler := &ConfigHandler{
+		name: name,
+		etcd: etcd,
+	}
+	handler.config.Store(config)
 
 	return handler
 }
 
 func (h *ConfigHandler) GetConfig() *Config {
-	return h.config
+	return h.config.Load()
+}
+
+// Revision is the etcd revision the configuration was loaded from, 0 when it
+// did not come from etcd.
+func (c *Config) Revision() int64 {
+	return c.revision
+}
+
+// Explain reports the value of key in every configuration source and which
+// one is in effect.
+func (h *ConfigHandler) Explain(key string) []ConfigSource {
+	return explainKey(h.GetConfig().layers, key)
 }
 
 func (h *ConfigHandler) WithConfig(name string) *Config {
 	config, err := h.requestConfig(name)
 	if err != nil {
-		log.Fatalf("no configuration found for application: %v\n%v", name, err.Error())
+		log.Fatalf("configuration error for application %s: %v", name, err)
 	}
 
 	return config
 }
 
-func (h *ConfigHandler) requestConfig(name string) (config *Config, err error) {
-	err = h.get("config_"+name, "yaml")
+// OnChange registers fn to be called with the new configuration whenever the
+// value under key changes in etcd. An empty key matches every change.
+func (h *ConfigHandler) OnChange(key string, fn func(config *Config)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.listeners = append(h.listeners, configListener{key: key, fn: fn})
+}
+
+// OnValueChange registers fn to be called with the value under key decoded
+// into T whenever it changes in etcd.
+func OnValueChange[T any](h *ConfigHandler, key string, fn func(value T)) {
+	h.OnChange(key, func(config *Config) {
+		var value T
+		if err := config.Env.UnmarshalKey(key, &value); err != nil {
+			slog.Warn("decode config key error", "key", key, "error", err)
+			return
+		}
+
+		fn(value)
+	})
+}
+
+func getRemoteConfig(ctx context.Context, etcd *clientv3.Client, name string) ([]byte, error) {
+	kv, err := getRemoteValue(ctx, etcd, name, 0)
 	if err != nil {
-		log.Fatalf("no configuration found for application: %v\n%v", name, err.Error())
+		return nil, err
 	}
 
-	err = h.viper.Unmarshal(&config)
+	return kv.Value, nil
+}
+
+// getRemoteValue reads the configuration of name as it was at revision rev,
+// or the latest one when rev is 0.
+func getRemoteValue(ctx context.Context, etcd *clientv3.Client, name string, rev int64) (*mvccpb.KeyValue, error) {
+	var opts []clientv3.OpOption
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev))
+	}
+
+	res, err := etcd.Get(ctx, configKey(name), opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	config.Env = h.viper
+	if len(res.Kvs) == 0 {
+		return nil, fmt.Errorf("no configuration found for application: %s", name)
+	}
 
-	return config, nil
+	return res.Kvs[0], nil
 }
 
-func (h *ConfigHandler) get(key string, format string) (err error) {
-	h.viper = viper.New()
+func (h *ConfigHandler) watch(ctx context.Context) {
+	watchFrom(ctx, h.etcd, configKey(h.name), h.GetConfig().revision+1, func(events []*clientv3.Event) {
+		for _, event := range events {
+			if event.Type != clientv3.EventTypePut {
+				continue
+			}
 
-	host := h.etcd.Endpoints()[0]
+			h.reload(event.Kv.Value, event.Kv.ModRevision)
+		}
+	}, h.resync)
+}
 
-	err = h.viper.AddRemoteProvider("etcd3", "http://"+host, key)
+// resync applies the latest configuration after the watch missed changes.
+func (h *ConfigHandler) resync(ctx context.Context) (int64, error) {
+	res, err := h.etcd.Get(ctx, configKey(h.name))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(res.Kvs) > 0 && res.Kvs[0].ModRevision != h.GetConfig().revision {
+		h.reload(res.Kvs[0].Value, res.Kvs[0].ModRevision)
+	}
+
+	return res.Header.Revision, nil
+}
+
+func (h *ConfigHandler) reload(remote []byte, revision int64) {
+	if err := h.apply(remote, revision); err != nil {
+		slog.Warn("ignoring invalid configuration", "app", h.name, "error", err)
+		return
+	}
+
+	fmt.Printf("config reloaded > %s (revision %d)\n", h.name, revision)
+}
+
+// apply resolves and validates the raw etcd value, swaps it in and notifies
+// the change listeners.
+func (h *ConfigHandler) apply(remote []byte, revision int64) error {
+	h.applying.Lock()
+	defer h.applying.Unlock()
+
+	config, err := h.resolve(remote)
 	if err != nil {
 		return err
 	}
+	config.revision = revision
 
-	h.viper.SetConfigType(format)
-	err = h.viper.ReadRemoteConfig()
+	if err := validateConfig(config); err != nil {
+		return err
+	}
 
-	return
+	previous := h.config.Swap(config)
+	h.saveCache(h.name, remote)
+	h.notify(previous, config)
+
+	return nil
 }
 
-func deepCopyConfig(original *ConfigHandler) (*ConfigHandler, error) {
-	data, err := json.Marshal(original)
+func (h *ConfigHandler) notify(previous *Config, config *Config) {
+	h.mu.Lock()
+	listeners := append([]configListener(nil), h.listeners...)
+	h.mu.Unlock()
+
+	for _, listener := range listeners {
+		if listener.key != "" && reflect.DeepEqual(previous.Env.Get(listener.key), config.Env.Get(listener.key)) {
+			continue
+		}
+
+		listener.fn(config)
+	}
+}
+
+func (h *ConfigHandler) resolve(remote []byte) (*Config, error) {
+	layers, err := h.resolveLayers(remote)
 	if err != nil {
 		return nil, err
 	}
 
-	var duplicate ConfigHandler
-	err = json.Unmarshal(data, &duplicate)
+	v, err := mergeLayers(layers)
 	if err != nil {
 		return nil, err
 	}
 
-	return &duplicate, nil
+	secrets, err := decryptSecrets(v)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := decodeConfig(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.newSettings != nil {
+		config.settings = h.newSettings()
+		if err := v.Unmarshal(config.settings); err != nil {
+			return nil, fmt.Errorf("decode configuration: %w", err)
+		}
+	}
+
+	config.layers = layers
+	config.secrets = secrets
+	config.remote = remote
+
+	return config, nil
+}
+
+func decodeConfig(v *viper.Viper) (*Config, error) {
+	config := new(Config)
+	if err := v.Unmarshal(config); err != nil {
+		return nil, err
+	}
+
+	config.Env = v
+
+	return config, nil
+}
+
+// validateConfig checks the base configuration and the application settings
+// decoded with it, reporting every problem at once.
+func validateConfig(config *Config) error {
+	var errs ConfigErrors
+
+	for _, value := range []any{config, config.settings} {
+		err := ValidateConfig(value)
+
+		var invalid ConfigErrors
+		if errors.As(err, &invalid) {
+			errs = append(errs, invalid...)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// Settings returns the application settings decoded with config, as declared
+// with CreateAppWithConfig. It is nil for another type.
+func Settings[T any](config *Config) *T {
+	settings, _ := config.settings.(*T)
+	return settings
+}
+
+func configKey(name string) string {
+	return "config_" + name
 }
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConfigHandlerStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		remote   string
+		fallback bool
+		cached   string
+		err      bool
+		url      string
+	}{
+		{"remote", "url: localhost:5\n", false, "", false, "localhost:5"},
+		{"missing key", "", false, "", true, ""},
+		{"missing key with fallback", "", true, "", false, "localhost:1"},
+		{"missing key with cache", "", true, "url: localhost:9\n", false, "localhost:9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			etcd, fake := newFakeEtcd()
+			if tt.remote != "" {
+				if _, err := fake.Put(context.Background(), configKey("test"), tt.remote); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			h := newTestConfigHandler("", WithDefaults(map[string]any{
+				"config_cache_dir": t.TempDir(),
+				"config_mode":      ConfigModeReadOnly,
+				"config_fallback":  tt.fallback,
+			}))
+			config, err := h.resolve(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.config.Store(config)
+			h.etcd = etcd
+
+			if tt.cached != "" {
+				h.saveCache(h.name, []byte(tt.cached))
+			}
+
+			// The watches and reconnection stop right away.
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err = h.start(ctx, nil)
+			if (err != nil) != tt.err {
+				t.Fatalf("start error = %v, want error %v", err, tt.err)
+			}
+			if err == nil && *h.GetConfig().Url != tt.url {
+				t.Fatalf("url = %q, want %q", *h.GetConfig().Url, tt.url)
+			}
+		})
+	}
+}
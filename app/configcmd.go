@@ -0,0 +1,272 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v3"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+func (app *App) configCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "compare and synchronize the embedded configuration with etcd",
+		Commands: append([]*cli.Command{
+			app.createConfigCommand("push", "write the embedded configuration to etcd", func(ctx context.Context, cmd *cli.Command, h *ConfigHandler) error {
+				return syncConfig(ctx, h.etcd, app.name, h.file, ConfigModePush)
+			}),
+			app.createConfigCommand("pull", "print the configuration stored in etcd", func(ctx context.Context, cmd *cli.Command, h *ConfigHandler) error {
+				remote, err := getRemoteConfig(ctx, h.etcd, app.name)
+				if err != nil {
+					return err
+				}
+
+				if !cmd.Bool("reveal") {
+					if remote, err = RedactConfig(remote); err != nil {
+						return err
+					}
+				}
+
+				if output := cmd.String("output"); output != "" {
+					return os.WriteFile(output, remote, 0o644)
+				}
+
+				_, err = os.Stdout.Write(remote)
+				return err
+			}, &cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "write the configuration to a file instead of stdout",
+			}, &cli.BoolFlag{
+				Name:  "reveal",
+				Usage: "print secrets instead of redacting them",
+			}),
+			app.createConfigCommand("diff", "show keys that differ between the embedded file and etcd", func(ctx context.Context, cmd *cli.Command, h *ConfigHandler) error {
+				remote, err := getRemoteConfig(ctx, h.etcd, app.name)
+				if err != nil {
+					return err
+				}
+
+				remoteLayer, err := settingsLayer(SourceEtcd, remote)
+				if err != nil {
+					return err
+				}
+
+				fileLayer, err := settingsLayer(SourceFile, h.file)
+				if err != nil {
+					return err
+				}
+
+				changes := diffConfig(remoteLayer.Values, fileLayer.Values)
+				if len(changes) == 0 {
+					fmt.Println("embedded configuration matches etcd")
+					return nil
+				}
+
+				fmt.Printf("--- etcd %s\n+++ %s\n", configKey(app.name), GetConfigPath(cmd.String("env")))
+				for _, change := range changes {
+					fmt.Println(change)
+				}
+
+				return nil
+			}),
+			app.newConfigCommand("explain", "show the value of a key in every configuration source", func(ctx context.Context, cmd *cli.Command, h *ConfigHandler, etcdErr error) error {
+				key := cmd.Args().First()
+				if key == "" {
+					return errors.New("configuration key is required")
+				}
+
+				return explainConfig(ctx, os.Stdout, h, key, etcdErr)
+			}),
+			app.createConfigCommand("put", "write a configuration file to an etcd namespace such as shared", func(ctx context.Context, cmd *cli.Command, h *ConfigHandler) error {
+				name, path := cmd.Args().Get(0), cmd.Args().Get(1)
+				if name == "" || path == "" {
+					return errors.New("namespace and file are required")
+				}
+
+				raw, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+
+				if _, err := settingsLayer(SourceFile, raw); err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+
+				if _, err := h.etcd.Put(ctx, configKey(name), string(raw)); err != nil {
+					return err
+				}
+
+				fmt.Printf("config pushed > %s\n", configKey(name))
+				return nil
+			}),
+			newEncryptCommand(),
+			newKeygenCommand(),
+		}, app.configHistoryCommands()...),
+	}
+}
+
+func newEncryptCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "encrypt",
+		Category:  "config",
+		Usage:     "encrypt a value for the configuration file, read from stdin when no argument is given",
+		ArgsUsage: "[value]",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			key, err := loadSecretKey()
+			if err != nil {
+				return err
+			}
+
+			value := cmd.Args().First()
+			if value == "" {
+				raw, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return err
+				}
+				value = strings.TrimRight(string(raw), "\r\n")
+			}
+
+			encrypted, err := EncryptSecret(key, value)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(encrypted)
+			return nil
+		},
+	}
+}
+
+func newKeygenCommand() *cli.Command {
+	return &cli.Command{
+		Name:     "keygen",
+		Category: "config",
+		Usage:    "generate a key for encrypted configuration values",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			key, err := GenerateSecretKey()
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(key)
+			return nil
+		},
+	}
+}
+
+func (app *App) createConfigCommand(name string, usage string, action func(ctx context.Context, cmd *cli.Command, h *ConfigHandler) error, flags ...cli.Flag) *cli.Command {
+	return app.newConfigCommand(name, usage, func(ctx context.Context, cmd *cli.Command, h *ConfigHandler, etcdErr error) error {
+		if etcdErr != nil {
+			return etcdErr
+		}
+
+		return action(ctx, cmd, h)
+	}, flags...)
+}
+
+// newConfigCommand is createConfigCommand for commands that can run without
+// etcd: action is called with the local configuration and the connection
+// error when etcd cannot be reached.
+func (app *App) newConfigCommand(name string, usage string, action func(ctx context.Context, cmd *cli.Command, h *ConfigHandler, etcdErr error) error, flags ...cli.Flag) *cli.Command {
+	return &cli.Command{
+		Name:     name,
+		Category: "config",
+		Usage:    usage,
+		Flags:    append(configFlags(), flags...),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			file, err := readConfigFile(app.fs, cmd.String("env"))
+			if err != nil {
+				log.Fatalf("read config file error: %v\n", err)
+			}
+
+			h, err := newConfigClient(app.name, file, WithOverrides(cmd.StringSlice("set")))
+			if h == nil {
+				return err
+			}
+			if h.etcd != nil {
+				defer h.etcd.Close()
+			}
+
+			return action(ctx, cmd, h, err)
+		},
+	}
+}
+
+// explainConfig writes the value of key in every configuration source to w.
+// When etcd cannot be reached (etcdErr) only the local sources are resolved
+// and the etcd layer is reported as unavailable.
+func explainConfig(ctx context.Context, w io.Writer, h *ConfigHandler, key string, etcdErr error) error {
+	var remote []byte
+	if etcdErr == nil {
+		var err error
+		if remote, err = getRemoteConfig(ctx, h.etcd, h.name); err != nil {
+			etcdErr = err
+		} else if err := h.loadImports(ctx, remote); err != nil {
+			fmt.Fprintf(w, "etcd: %v\n", err)
+		}
+	}
+
+	config, err := h.resolve(remote)
+	if err != nil {
+		return err
+	}
+
+	sources := explainKey(config.layers, key)
+	if len(sources) == 0 {
+		fmt.Fprintf(w, "%s is not set in any source\n", key)
+	}
+
+	for _, source := range sources {
+		marker := " "
+		if source.Effective {
+			marker = "*"
+		}
+
+		fmt.Fprintf(w, "%s %-8s %s = %v\n", marker, source.Source, source.Key, RedactValue(source.Key, source.Value, config.secrets))
+	}
+
+	if etcdErr != nil {
+		fmt.Fprintf(w, "? %-8s unavailable: %v\n", SourceEtcd, etcdErr)
+	}
+
+	return nil
+}
+
+// diffConfig compares two flattened settings maps and returns one line per
+// removed (-), added (+) or changed (~) key, sorted by key.
+func diffConfig(remoteKeys map[string]any, localKeys map[string]any) []string {
+	keys := make([]string, 0, len(remoteKeys)+len(localKeys))
+	for key := range remoteKeys {
+		keys = append(keys, key)
+	}
+	for key := range localKeys {
+		if _, ok := remoteKeys[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []string
+	for _, key := range keys {
+		before, inRemote := remoteKeys[key]
+		after, inLocal := localKeys[key]
+
+		switch {
+		case !inLocal:
+			changes = append(changes, fmt.Sprintf("- %s: %v", key, RedactValue(key, before, nil)))
+		case !inRemote:
+			changes = append(changes, fmt.Sprintf("+ %s: %v", key, RedactValue(key, after, nil)))
+		case !reflect.DeepEqual(before, after):
+			changes = append(changes, fmt.Sprintf("~ %s: %v -> %v", key, RedactValue(key, before, nil), RedactValue(key, after, nil)))
+		}
+	}
+
+	return changes
+}
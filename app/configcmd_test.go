@@ -0,0 +1,44 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExplainConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		etcdErr error
+		want    []string
+	}{
+		{"etcd", nil, []string{"  file     url = localhost:2", "* etcd     url = localhost:3"}},
+		{"etcd unavailable", errors.New("etcd connection timeout"), []string{"* file     url = localhost:2", "? etcd     unavailable: etcd connection timeout"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestConfigHandler("url: localhost:2\n")
+			if tt.etcdErr == nil {
+				etcd, fake := newFakeEtcd()
+				if _, err := fake.Put(context.Background(), configKey("test"), "url: localhost:3\n"); err != nil {
+					t.Fatal(err)
+				}
+				h.etcd = etcd
+			}
+
+			var out bytes.Buffer
+			if err := explainConfig(context.Background(), &out, h, "url", tt.etcdErr); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, line := range tt.want {
+				if !strings.Contains(out.String(), line+"\n") {
+					t.Fatalf("output = %q, want line %q", out.String(), line)
+				}
+			}
+		})
+	}
+}
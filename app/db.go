@@ -1,44 +1,287 @@
 package app
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/driver/pgdriver"
-	"github.com/uptrace/bun/extra/bundebug"
+	"github.com/uptrace/bun/extra/bunotel"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const (
+	TLSModeDisable    = "disable"
+	TLSModeRequire    = "require"
+	TLSModeVerifyCA   = "verify-ca"
+	TLSModeVerifyFull = "verify-full"
+)
+
+type StorageConfig struct {
+	MaxOpenConns     int              `mapstructure:"max_open_conns" validate:"omitempty,min=0"`
+	MaxIdleConns     int              `mapstructure:"max_idle_conns" validate:"omitempty,min=0"`
+	ConnMaxLifetime  time.Duration    `mapstructure:"conn_max_lifetime" validate:"omitempty,min=0s"`
+	ConnMaxIdleTime  time.Duration    `mapstructure:"conn_max_idle_time" validate:"omitempty,min=0s"`
+	StatementTimeout time.Duration    `mapstructure:"statement_timeout" validate:"omitempty,min=0s"`
+	ApplicationName  string           `mapstructure:"application_name"`
+	TLS              StorageTLSConfig `mapstructure:"tls"`
+	Log              QueryLogConfig   `mapstructure:"log"`
+	Replicas         []string         `mapstructure:"replicas" validate:"omitempty,dive,dsn"`
+	HealthInterval   time.Duration    `mapstructure:"health_interval" validate:"omitempty,min=100ms"`
+	StickyWindow     time.Duration    `mapstructure:"sticky_window" validate:"omitempty,min=0s"`
+}
+
+type StorageTLSConfig struct {
+	Mode       string `mapstructure:"mode" validate:"omitempty,oneof=disable require verify-ca verify-full"`
+	CAFile     string `mapstructure:"ca_file"`
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+	ServerName string `mapstructure:"server_name"`
+}
+
 type StorageHandler struct {
-	dbOnce sync.Once
-	db     *bun.DB
+	dbOnce      sync.Once
+	db          *bun.DB
+	primaryOnce sync.Once
+	primary     *bun.DB
+	replicas    []*replica
+	next        atomic.Uint64
+	done        chan struct{}
 
-	dsn string
+	dsn    string
+	config StorageConfig
 }
 
-func NewStorageHandler(dsn string) *StorageHandler {
+func NewStorageHandler(dsn string, config StorageConfig) *StorageHandler {
 	return &StorageHandler{
-		dsn: dsn,
+		dsn:    dsn,
+		config: config,
 	}
 }
 
 func (h *StorageHandler) Database() *bun.DB {
 	h.dbOnce.Do(func() {
-		driverOptions := pgdriver.NewConnector(
-			pgdriver.WithDSN(h.dsn),
-			pgdriver.WithTLSConfig(nil),
-		)
+		var opts []bun.DBOption
+		if len(h.config.Replicas) > 0 {
+			opts = append(opts, bun.WithConnResolver(replicaResolver{h: h}))
+		}
+
+		h.db = h.open(h.dsn, opts...)
+		h.db.AddQueryHook(&writeTracker{})
 
-		conn := sql.OpenDB(driverOptions)
-		db := bun.NewDB(conn, pgdialect.New())
+		for _, dsn := range h.config.Replicas {
+			r := &replica{db: h.open(dsn)}
+			r.healthy.Store(true)
 
-		db.AddQueryHook(bundebug.NewQueryHook(
-			bundebug.WithEnabled(true),
-			bundebug.WithVerbose(true),
-		))
+			h.replicas = append(h.replicas, r)
+		}
 
-		h.db = db
+		if len(h.replicas) > 0 {
+			h.done = make(chan struct{})
+			go h.watchReplicas(h.done)
+		}
 	})
 
 	return h.db
 }
+
+// Primary returns the primary database without the routing of selects to
+// replicas, for the tools that must never read stale data such as migrations
+// and seeding. It shares the connections and models of Database.
+func (h *StorageHandler) Primary() *bun.DB {
+	db := h.Database()
+	if len(h.replicas) == 0 {
+		return db
+	}
+
+	h.primaryOnce.Do(func() {
+		h.primary = bun.NewDB(db.DB, db.Dialect())
+		h.addQueryHooks(h.primary, h.dsn)
+	})
+
+	return h.primary
+}
+
+func (h *StorageHandler) Close() error {
+	if h.db == nil {
+		return nil
+	}
+
+	if h.done != nil {
+		close(h.done)
+	}
+
+	var errs []error
+	for _, r := range h.replicas {
+		errs = append(errs, r.db.Close())
+	}
+
+	return errors.Join(append(errs, h.db.Close())...)
+}
+
+func (h *StorageHandler) open(dsn string, opts ...bun.DBOption) *bun.DB {
+	tlsConfig, err := h.tlsConfig(dsn)
+	if err != nil {
+		panic(err)
+	}
+
+	options := []pgdriver.Option{
+		pgdriver.WithDSN(dsn),
+		pgdriver.WithTLSConfig(tlsConfig),
+	}
+
+	if h.config.ApplicationName != "" {
+		options = append(options, pgdriver.WithApplicationName(h.config.ApplicationName))
+	}
+
+	if h.config.StatementTimeout > 0 {
+		options = append(options, pgdriver.WithConnParams(map[string]interface{}{
+			"statement_timeout": strconv.FormatInt(h.config.StatementTimeout.Milliseconds(), 10),
+		}))
+	}
+
+	conn := sql.OpenDB(pgdriver.NewConnector(options...))
+	h.configurePool(conn)
+
+	db := bun.NewDB(conn, pgdialect.New(), opts...)
+	h.addQueryHooks(db, dsn)
+
+	return db
+}
+
+func (h *StorageHandler) addQueryHooks(db *bun.DB, dsn string) {
+	db.AddQueryHook(NewQueryLogHook(h.config.Log))
+	db.AddQueryHook(bunotel.NewQueryHook(
+		bunotel.WithDBName(dsnDatabase(dsn)),
+	))
+}
+
+func (h *StorageHandler) configurePool(conn *sql.DB) {
+	if h.config.MaxOpenConns > 0 {
+		conn.SetMaxOpenConns(h.config.MaxOpenConns)
+	}
+	if h.config.MaxIdleConns > 0 {
+		conn.SetMaxIdleConns(h.config.MaxIdleConns)
+	}
+	if h.config.ConnMaxLifetime > 0 {
+		conn.SetConnMaxLifetime(h.config.ConnMaxLifetime)
+	}
+	if h.config.ConnMaxIdleTime > 0 {
+		conn.SetConnMaxIdleTime(h.config.ConnMaxIdleTime)
+	}
+}
+
+func (h *StorageHandler) tlsConfig(dsn string) (*tls.Config, error) {
+	c := h.config.TLS
+
+	if c.Mode == "" || c.Mode == TLSModeDisable {
+		return nil, nil
+	}
+
+	serverName := c.ServerName
+	if serverName == "" {
+		serverName = dsnHost(dsn)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: serverName,
+	}
+
+	if c.CAFile != "" {
+		rawCA, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read database CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(rawCA) {
+			return nil, errors.New("database CA file contains no certificates")
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load database client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	switch c.Mode {
+	case TLSModeRequire:
+		tlsConfig.InsecureSkipVerify = true
+	case TLSModeVerifyCA:
+		// Verify the chain against the configured roots but skip the host name check.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, tlsConfig.RootCAs)
+		}
+	case TLSModeVerifyFull:
+	default:
+		return nil, fmt.Errorf("unsupported database tls mode: %s", c.Mode)
+	}
+
+	return tlsConfig, nil
+}
+
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("database server sent no certificates")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+
+	return err
+}
+
+func dsnHost(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return ""
+	}
+
+	if host, _, err := net.SplitHostPort(u.Host); err == nil {
+		return host
+	}
+
+	return u.Host
+}
+
+func dsnDatabase(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(u.Path, "/")
+}
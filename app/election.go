@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Elections and locks are held through an etcd session whose lease is kept
+// alive in the background. When the lease is lost, e.g. because etcd was
+// unreachable for longer than its TTL, another replica may take over, so the
+// context handed to the job is cancelled.
+const (
+	electionPrefix = "elections/"
+	lockPrefix     = "locks/"
+)
+
+var ErrLeaseLost = errors.New("etcd session lease lost")
+
+// Elect runs fn on a single replica at a time among those electing under
+// name. It blocks until this replica becomes leader, campaigns again if the
+// lease is lost while fn runs and fn fails, and returns fn's error once it
+// completes.
+func (app *App) Elect(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	if app.configHandler == nil || app.configHandler.etcd == nil {
+		return errors.New("etcd is not connected")
+	}
+
+	candidate, err := os.Hostname()
+	if err != nil {
+		candidate = app.name
+	}
+
+	for {
+		err := app.lead(ctx, name, candidate, fn)
+		if !errors.Is(err, ErrLeaseLost) {
+			return err
+		}
+
+		slog.Warn("leadership lost, campaigning again", "election", name)
+	}
+}
+
+func (app *App) lead(ctx context.Context, name string, candidate string, fn func(ctx context.Context) error) error {
+	session, err := concurrency.NewSession(app.configHandler.etcd, concurrency.WithTTL(registryTTL), concurrency.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer closeSession(session)
+
+	election := concurrency.NewElection(session, electionPrefix+name)
+	if err := election.Campaign(ctx, candidate); err != nil {
+		return err
+	}
+	fmt.Printf("elected leader > %s (%s)\n", name, candidate)
+
+	jobCtx, cancel := sessionContext(ctx, session)
+	defer cancel(nil)
+
+	// fn may complete right as the lease is lost: it only runs again when it
+	// did not succeed.
+	err = fn(jobCtx)
+	if errors.Is(context.Cause(jobCtx), ErrLeaseLost) {
+		if err != nil {
+			return ErrLeaseLost
+		}
+		return nil
+	}
+
+	if resignErr := election.Resign(context.WithoutCancel(ctx)); resignErr != nil {
+		slog.Warn("resign error", "election", name, "error", resignErr)
+	}
+
+	return err
+}
+
+type DistributedLock struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	mutex   *concurrency.Mutex
+	session *concurrency.Session
+}
+
+// Lock acquires the lock named key, blocking until it is free or ctx is done.
+// The lock's Context is cancelled if the lease is lost.
+func (app *App) Lock(ctx context.Context, key string) (*DistributedLock, error) {
+	if app.configHandler == nil || app.configHandler.etcd == nil {
+		return nil, errors.New("etcd is not connected")
+	}
+
+	session, err := concurrency.NewSession(app.configHandler.etcd, concurrency.WithTTL(registryTTL), concurrency.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	mutex := concurrency.NewMutex(session, lockPrefix+key)
+	if err := mutex.Lock(ctx); err != nil {
+		closeSession(session)
+		return nil, err
+	}
+
+	lockCtx, cancel := sessionContext(ctx, session)
+
+	return &DistributedLock{
+		ctx:     lockCtx,
+		cancel:  cancel,
+		mutex:   mutex,
+		session: session,
+	}, nil
+}
+
+// Context is done once the lock is released or its lease is lost.
+func (l *DistributedLock) Context() context.Context {
+	return l.ctx
+}
+
+func (l *DistributedLock) Unlock() error {
+	defer closeSession(l.session)
+	defer l.cancel(nil)
+
+	if errors.Is(context.Cause(l.ctx), ErrLeaseLost) {
+		return ErrLeaseLost
+	}
+
+	return l.mutex.Unlock(context.WithoutCancel(l.ctx))
+}
+
+// sessionContext returns a context derived from ctx that is cancelled with
+// ErrLeaseLost when the lease of session is lost.
+func sessionContext(ctx context.Context, session *concurrency.Session) (context.Context, context.CancelCauseFunc) {
+	sessionCtx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		select {
+		case <-session.Done():
+			cancel(ErrLeaseLost)
+		case <-sessionCtx.Done():
+		}
+	}()
+
+	return sessionCtx, cancel
+}
+
+// closeSession revokes the lease of session. Session.Close revokes it with
+// the context the session was created with, which is often done by then.
+func closeSession(session *concurrency.Session) {
+	session.Orphan()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionRevokeTimeout)
+	defer cancel()
+
+	if _, err := session.Client().Revoke(ctx, session.Lease()); err != nil {
+		slog.Warn("session lease revoke error", "lease", session.Lease(), "error", err)
+	}
+}
+
+const sessionRevokeTimeout = 2 * time.Second
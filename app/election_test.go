@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"testing"
+	"time"
+)
+
+func newTestSession(t *testing.T, ctx context.Context) (*concurrency.Session, *fakeEtcd) {
+	t.Helper()
+
+	etcd, fake := newFakeEtcd()
+	session, err := concurrency.NewSession(etcd, concurrency.WithTTL(registryTTL), concurrency.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return session, fake
+}
+
+func TestSessionContextLeaseLost(t *testing.T) {
+	session, fake := newTestSession(t, context.Background())
+	defer closeSession(session)
+
+	ctx, cancel := sessionContext(context.Background(), session)
+	defer cancel(nil)
+
+	fake.expire(session.Lease())
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("expected the context to be cancelled when the lease is lost")
+	}
+
+	if !errors.Is(context.Cause(ctx), ErrLeaseLost) {
+		t.Fatalf("cause = %v, want ErrLeaseLost", context.Cause(ctx))
+	}
+}
+
+func TestSessionContextCancelled(t *testing.T) {
+	session, _ := newTestSession(t, context.Background())
+	defer closeSession(session)
+
+	ctx, cancel := sessionContext(context.Background(), session)
+	cancel(nil)
+
+	if cause := context.Cause(ctx); !errors.Is(cause, context.Canceled) {
+		t.Fatalf("cause = %v, want context.Canceled", cause)
+	}
+}
+
+func TestCloseSessionAfterContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	session, fake := newTestSession(t, ctx)
+
+	cancel()
+	<-session.Done()
+
+	closeSession(session)
+
+	if revoked := fake.revokedLeases(); len(revoked) != 1 || revoked[0] != session.Lease() {
+		t.Fatalf("revoked %v, want the session lease %d", revoked, session.Lease())
+	}
+}
+
+func TestCloseSessionRevokeError(t *testing.T) {
+	session, fake := newTestSession(t, context.Background())
+	fake.revokeErr = errors.New("etcd unavailable")
+
+	// The error is logged, the lease expires on its own.
+	closeSession(session)
+
+	if len(fake.revokedLeases()) != 1 {
+		t.Fatalf("expected a revoke attempt")
+	}
+}
+
+func TestUnlockAfterLeaseLost(t *testing.T) {
+	session, fake := newTestSession(t, context.Background())
+	ctx, cancel := sessionContext(context.Background(), session)
+	lock := &DistributedLock{ctx: ctx, cancel: cancel, mutex: concurrency.NewMutex(session, lockPrefix+"job"), session: session}
+
+	fake.expire(session.Lease())
+	<-lock.Context().Done()
+
+	if err := lock.Unlock(); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Unlock = %v, want ErrLeaseLost", err)
+	}
+	if revoked := fake.revokedLeases(); len(revoked) != 1 || revoked[0] != session.Lease() {
+		t.Fatalf("revoked %v, want the session lease %d", revoked, session.Lease())
+	}
+}
+
+func TestElectWithoutEtcd(t *testing.T) {
+	app := &App{}
+
+	if err := app.Elect(context.Background(), "job", func(ctx context.Context) error { return nil }); err == nil {
+		t.Fatalf("expected an error without etcd")
+	}
+	if _, err := app.Lock(context.Background(), "job"); err == nil {
+		t.Fatalf("expected an error without etcd")
+	}
+}
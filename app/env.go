@@ -0,0 +1,126 @@
+package app
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Environments are discovered from the config/config.<env>.yml files of the
+// embedded filesystem. A file may set `extends: <env>` to start from another
+// environment's configuration and override some of its keys.
+const (
+	configDir  = "config"
+	extendsKey = "extends"
+	envEnv     = "APP_ENV"
+)
+
+// IsProduction reports whether env names a production environment, where
+// development helpers such as the API docs page are never served.
+func IsProduction(env string) bool {
+	return env == "production" || env == "prod"
+}
+
+func GetConfigPath(env string) string {
+	return path.Join(configDir, "config."+env+".yml")
+}
+
+// Environments lists the environments with a configuration file in efs.
+func Environments(efs fs.FS) ([]string, error) {
+	files, err := fs.Glob(efs, GetConfigPath("*"))
+	if err != nil {
+		return nil, err
+	}
+
+	envs := make([]string, 0, len(files))
+	for _, file := range files {
+		envs = append(envs, strings.TrimSuffix(strings.TrimPrefix(path.Base(file), "config."), ".yml"))
+	}
+	sort.Strings(envs)
+
+	return envs, nil
+}
+
+// readConfigFile returns the configuration of env with the environments it
+// extends merged underneath it.
+func readConfigFile(efs fs.FS, env string) ([]byte, error) {
+	envs, err := Environments(efs)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := readEnvSettings(efs, env, envs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(settings)
+}
+
+func readEnvSettings(efs fs.FS, env string, envs []string, seen []string) (map[string]any, error) {
+	if !containsEnv(envs, env) {
+		return nil, fmt.Errorf("unknown environment %q, expected one of: %s", env, strings.Join(envs, ", "))
+	}
+
+	for _, name := range seen {
+		if name == env {
+			return nil, fmt.Errorf("environment %s extends itself: %s -> %s", env, strings.Join(seen, " -> "), env)
+		}
+	}
+
+	raw, err := fs.ReadFile(efs, GetConfigPath(env))
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]any)
+	if err := yaml.Unmarshal(raw, &settings); err != nil {
+		return nil, fmt.Errorf("%s: %w", GetConfigPath(env), err)
+	}
+
+	parent, ok := settings[extendsKey]
+	if !ok {
+		return settings, nil
+	}
+	delete(settings, extendsKey)
+
+	name, ok := parent.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s must be an environment name", GetConfigPath(env), extendsKey)
+	}
+
+	base, err := readEnvSettings(efs, name, envs, append(seen, env))
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeSettings(base, settings), nil
+}
+
+// mergeSettings deep merges override into base.
+func mergeSettings(base map[string]any, override map[string]any) map[string]any {
+	for key, value := range override {
+		nested, ok := value.(map[string]any)
+		if current, isMap := base[key].(map[string]any); ok && isMap {
+			base[key] = mergeSettings(current, nested)
+			continue
+		}
+
+		base[key] = value
+	}
+
+	return base
+}
+
+func containsEnv(envs []string, env string) bool {
+	for _, name := range envs {
+		if name == env {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"sync"
+)
+
+// fakeEtcd serves the etcd calls the tests need from memory: single-key Get
+// and Put, watches that stay open until cancelled, and leases kept alive until
+// revoked or expired with expire.
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Watcher
+	clientv3.Lease
+
+	mu         sync.Mutex
+	rev        int64
+	kvs        map[string]*mvccpb.KeyValue
+	nextLease  clientv3.LeaseID
+	keepAlives map[clientv3.LeaseID]chan *clientv3.LeaseKeepAliveResponse
+	revoked    []clientv3.LeaseID
+	revokeErr  error
+}
+
+func newFakeEtcd() (*clientv3.Client, *fakeEtcd) {
+	f := &fakeEtcd{
+		rev:        1,
+		kvs:        make(map[string]*mvccpb.KeyValue),
+		keepAlives: make(map[clientv3.LeaseID]chan *clientv3.LeaseKeepAliveResponse),
+	}
+
+	client := clientv3.NewCtxClient(context.Background())
+	client.KV, client.Watcher, client.Lease = f, f, f
+
+	return client, f
+}
+
+func (f *fakeEtcd) header() *etcdserverpb.ResponseHeader {
+	return &etcdserverpb.ResponseHeader{Revision: f.rev}
+}
+
+func (f *fakeEtcd) Get(_ context.Context, key string, _ ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	res := &clientv3.GetResponse{Header: f.header()}
+	if kv, ok := f.kvs[key]; ok {
+		res.Kvs = []*mvccpb.KeyValue{kv}
+		res.Count = 1
+	}
+
+	return res, nil
+}
+
+func (f *fakeEtcd) Put(_ context.Context, key string, value string, _ ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rev++
+	kv := &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), ModRevision: f.rev, CreateRevision: f.rev, Version: 1}
+	if prev, ok := f.kvs[key]; ok {
+		kv.CreateRevision, kv.Version = prev.CreateRevision, prev.Version+1
+	}
+	f.kvs[key] = kv
+
+	return &clientv3.PutResponse{Header: f.header()}, nil
+}
+
+func (f *fakeEtcd) Watch(ctx context.Context, _ string, _ ...clientv3.OpOption) clientv3.WatchChan {
+	ch := make(chan clientv3.WatchResponse)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+
+	return ch
+}
+
+func (f *fakeEtcd) Grant(_ context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextLease++
+	return &clientv3.LeaseGrantResponse{ID: f.nextLease, TTL: ttl}, nil
+}
+
+func (f *fakeEtcd) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	f.keepAlives[id] = ch
+	go func() {
+		<-ctx.Done()
+		f.expire(id)
+	}()
+
+	return ch, nil
+}
+
+// expire closes the keep alive channel of lease id, as etcd does when the
+// lease is lost.
+func (f *fakeEtcd) expire(id clientv3.LeaseID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ch, ok := f.keepAlives[id]; ok {
+		close(ch)
+		delete(f.keepAlives, id)
+	}
+}
+
+func (f *fakeEtcd) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.revoked = append(f.revoked, id)
+	err := f.revokeErr
+	f.mu.Unlock()
+
+	f.expire(id)
+
+	return &clientv3.LeaseRevokeResponse{Header: f.header()}, err
+}
+
+func (f *fakeEtcd) revokedLeases() []clientv3.LeaseID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]clientv3.LeaseID(nil), f.revoked...)
+}
+
+func (f *fakeEtcd) Close() error {
+	return nil
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// When config_fallback is enabled and the configuration cannot be loaded from
+// etcd at startup, the handler serves the last configuration read from etcd (cached on disk under
+// config_cache_dir) or the embedded file, and keeps trying to connect in the
+// background.
+
+func (h *ConfigHandler) startOffline(ctx context.Context, cause error) {
+	slog.Warn("etcd configuration unavailable, starting with local configuration", "app", h.name, "error", cause)
+
+	if cached := h.loadCache(h.name); cached != nil {
+		if config, err := h.resolve(cached); err == nil {
+			h.config.Store(config)
+			slog.Warn("using cached etcd configuration", "app", h.name, "path", h.cachePath(h.name))
+		} else {
+			slog.Warn("ignoring cached configuration", "app", h.name, "error", err)
+		}
+	}
+
+	if h.etcd == nil {
+		return
+	}
+
+	go h.reconnect(ctx)
+}
+
+func (h *ConfigHandler) reconnect(ctx context.Context) {
+	delay := time.Second
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := waitEtcd(ctx, h.etcd, delay); err == nil {
+			break
+		}
+
+		delay = min(delay*2, 30*time.Second)
+	}
+
+	if err := syncConfig(ctx, h.etcd, h.name, h.file, h.GetConfig().Env.GetString("config_mode")); err != nil {
+		slog.Error("config sync error after reconnecting", "app", h.name, "error", err)
+	}
+
+	kv, err := getRemoteValue(ctx, h.etcd, h.name, 0)
+	if err != nil {
+		slog.Error("config read error after reconnecting", "app", h.name, "error", err)
+	} else {
+		if err := h.loadImports(ctx, kv.Value); err != nil {
+			slog.Error("config import error after reconnecting", "app", h.name, "error", err)
+		}
+
+		if err := h.apply(kv.Value, kv.ModRevision); err != nil {
+			slog.Warn("ignoring invalid configuration", "app", h.name, "error", err)
+		}
+	}
+
+	fmt.Printf("etcd reconnected > %s\n", h.name)
+	h.watchImports(ctx)
+	h.watch(ctx)
+}
+
+func (h *ConfigHandler) cachePath(name string) string {
+	dir := h.GetConfig().Env.GetString("config_cache_dir")
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			base = os.TempDir()
+		}
+		dir = filepath.Join(base, "alpha-omega")
+	}
+
+	return filepath.Join(dir, configKey(name)+".yml")
+}
+
+func (h *ConfigHandler) loadCache(name string) []byte {
+	raw, err := os.ReadFile(h.cachePath(name))
+	if err != nil {
+		return nil
+	}
+
+	return raw
+}
+
+func (h *ConfigHandler) saveCache(name string, remote []byte) {
+	path := h.cachePath(name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		slog.Warn("config cache error", "path", path, "error", err)
+		return
+	}
+
+	if err := os.WriteFile(path, remote, 0o600); err != nil {
+		slog.Warn("config cache error", "path", path, "error", err)
+	}
+}
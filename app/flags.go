@@ -0,0 +1,279 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"hash/fnv"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Feature flags are stored as JSON under flags/<name> and cached in process,
+// kept up to date by a watch on the prefix.
+const (
+	flagsPrefix = "flags/"
+
+	FlagBoolean    = "boolean"
+	FlagPercentage = "percentage"
+	FlagTargeted   = "targeted"
+)
+
+// Flag is enabled for everyone (boolean), for a stable share of users
+// (percentage) or for the listed users and roles (targeted). A disabled flag
+// is off for everyone.
+type Flag struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Enabled    bool     `json:"enabled"`
+	Percentage int      `json:"percentage,omitempty"`
+	Users      []string `json:"users,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+}
+
+// FlagSubject is who a flag is evaluated for. Users are matched by id or
+// email.
+type FlagSubject struct {
+	UserID int64
+	Email  string
+	Roles  []string
+}
+
+func (f Flag) Validate() error {
+	if f.Name == "" || strings.Contains(f.Name, "/") {
+		return fmt.Errorf("invalid flag name %q", f.Name)
+	}
+
+	switch f.Type {
+	case FlagBoolean, FlagTargeted:
+	case FlagPercentage:
+		if f.Percentage < 0 || f.Percentage > 100 {
+			return fmt.Errorf("percentage must be between 0 and 100, got %d", f.Percentage)
+		}
+	default:
+		return fmt.Errorf("unknown flag type %q, expected %s, %s or %s", f.Type, FlagBoolean, FlagPercentage, FlagTargeted)
+	}
+
+	return nil
+}
+
+func (f Flag) Evaluate(subject FlagSubject) bool {
+	if !f.Enabled {
+		return false
+	}
+
+	switch f.Type {
+	case FlagBoolean:
+		return true
+	case FlagPercentage:
+		if subject.UserID == 0 && subject.Email == "" {
+			return false
+		}
+
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(f.Name + ":" + subject.key()))
+		return int(hash.Sum32()%100) < f.Percentage
+	case FlagTargeted:
+		for _, user := range f.Users {
+			if (subject.UserID != 0 && user == strconv.FormatInt(subject.UserID, 10)) || (subject.Email != "" && user == subject.Email) {
+				return true
+			}
+		}
+
+		for _, role := range f.Roles {
+			for _, subjectRole := range subject.Roles {
+				if role == subjectRole {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (s FlagSubject) key() string {
+	if s.UserID != 0 {
+		return strconv.FormatInt(s.UserID, 10)
+	}
+
+	return s.Email
+}
+
+type FlagStore struct {
+	etcd *clientv3.Client
+
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+// NewFlagStore loads every flag and keeps the cache in sync until ctx is done.
+func NewFlagStore(ctx context.Context, etcd *clientv3.Client) (*FlagStore, error) {
+	store := &FlagStore{
+		etcd:  etcd,
+		flags: make(map[string]Flag),
+	}
+
+	rev, err := store.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	go store.watch(ctx, rev+1)
+
+	return store, nil
+}
+
+func (s *FlagStore) watch(ctx context.Context, rev int64) {
+	watchFrom(ctx, s.etcd, flagsPrefix, rev, func(events []*clientv3.Event) {
+		for _, event := range events {
+			if event.Type == clientv3.EventTypeDelete {
+				s.mu.Lock()
+				delete(s.flags, strings.TrimPrefix(string(event.Kv.Key), flagsPrefix))
+				s.mu.Unlock()
+				continue
+			}
+
+			s.put(event.Kv.Key, event.Kv.Value)
+		}
+	}, s.load, clientv3.WithPrefix())
+}
+
+// load replaces the cached flags with the ones stored in etcd and returns the
+// revision they were read at.
+func (s *FlagStore) load(ctx context.Context) (int64, error) {
+	res, err := s.etcd.Get(ctx, flagsPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	flags := make(map[string]Flag, len(res.Kvs))
+	for _, kv := range res.Kvs {
+		if flag, ok := parseFlag(kv.Key, kv.Value); ok {
+			flags[flag.Name] = flag
+		}
+	}
+
+	s.mu.Lock()
+	s.flags = flags
+	s.mu.Unlock()
+
+	return res.Header.Revision, nil
+}
+
+func (s *FlagStore) put(key []byte, value []byte) {
+	flag, ok := parseFlag(key, value)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	s.flags[flag.Name] = flag
+	s.mu.Unlock()
+}
+
+func parseFlag(key []byte, value []byte) (Flag, bool) {
+	var flag Flag
+	if err := json.Unmarshal(value, &flag); err != nil {
+		slog.Warn("ignoring invalid flag", "key", string(key), "error", err)
+		return Flag{}, false
+	}
+	flag.Name = strings.TrimPrefix(string(key), flagsPrefix)
+
+	return flag, true
+}
+
+// Enabled evaluates the named flag for subject. Unknown flags are off.
+func (s *FlagStore) Enabled(name string, subject FlagSubject) bool {
+	s.mu.RLock()
+	flag, ok := s.flags[name]
+	s.mu.RUnlock()
+
+	return ok && flag.Evaluate(subject)
+}
+
+func (s *FlagStore) List() []Flag {
+	s.mu.RLock()
+	flags := make([]Flag, 0, len(s.flags))
+	for _, flag := range s.flags {
+		flags = append(flags, flag)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+
+	return flags
+}
+
+func (s *FlagStore) Set(ctx context.Context, flag Flag) error {
+	return setFlag(ctx, s.etcd, flag)
+}
+
+func (s *FlagStore) Delete(ctx context.Context, name string) error {
+	return deleteFlag(ctx, s.etcd, name)
+}
+
+func setFlag(ctx context.Context, etcd *clientv3.Client, flag Flag) error {
+	if err := flag.Validate(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(flag)
+	if err != nil {
+		return err
+	}
+
+	_, err = etcd.Put(ctx, flagsPrefix+flag.Name, string(raw))
+	return err
+}
+
+func deleteFlag(ctx context.Context, etcd *clientv3.Client, name string) error {
+	res, err := etcd.Delete(ctx, flagsPrefix+name)
+	if err != nil {
+		return err
+	}
+
+	if res.Deleted == 0 {
+		return fmt.Errorf("no flag named %s", name)
+	}
+
+	return nil
+}
+
+type flagsContextKey struct{}
+
+type flagsContext struct {
+	store   *FlagStore
+	subject func() FlagSubject
+}
+
+// ContextWithFlags makes the flags, evaluated for subject, available to
+// FlagEnabled.
+func ContextWithFlags(ctx context.Context, store *FlagStore, subject FlagSubject) context.Context {
+	return contextWithFlags(ctx, store, func() FlagSubject {
+		return subject
+	})
+}
+
+// contextWithFlags is ContextWithFlags with the subject resolved on the first
+// flag evaluation.
+func contextWithFlags(ctx context.Context, store *FlagStore, subject func() FlagSubject) context.Context {
+	return context.WithValue(ctx, flagsContextKey{}, flagsContext{store: store, subject: sync.OnceValue(subject)})
+}
+
+// FlagEnabled evaluates the named flag for the subject of ctx. It is false
+// when ctx carries no flags.
+func FlagEnabled(ctx context.Context, name string) bool {
+	flags, ok := ctx.Value(flagsContextKey{}).(flagsContext)
+	if !ok || flags.store == nil {
+		return false
+	}
+
+	return flags.store.Enabled(name, flags.subject())
+}
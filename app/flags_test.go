@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"github.com/alpha-omega-corp/core/app/proto"
+	"github.com/uptrace/bunrouter"
+	"google.golang.org/grpc"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeAuthService struct {
+	proto.AuthServiceClient
+	user        *proto.User
+	matrix      map[string]bool
+	validations int
+}
+
+func (s *fakeAuthService) Validate(_ context.Context, req *proto.ValidateRequest, _ ...grpc.CallOption) (*proto.ValidateResponse, error) {
+	s.validations++
+	return &proto.ValidateResponse{User: s.user}, nil
+}
+
+func (s *fakeAuthService) GetUserPermissions(context.Context, *proto.GetUserPermissionsRequest, ...grpc.CallOption) (*proto.GetUserPermissionsResponse, error) {
+	return &proto.GetUserPermissionsResponse{Matrix: s.matrix}, nil
+}
+
+func TestFlagEvaluate(t *testing.T) {
+	user := FlagSubject{UserID: 7, Email: "a@example.com", Roles: []string{"admin"}}
+
+	tests := []struct {
+		name    string
+		flag    Flag
+		subject FlagSubject
+		want    bool
+	}{
+		{"disabled", Flag{Type: FlagBoolean}, user, false},
+		{"boolean", Flag{Type: FlagBoolean, Enabled: true}, FlagSubject{}, true},
+		{"full percentage", Flag{Name: "f", Type: FlagPercentage, Enabled: true, Percentage: 100}, user, true},
+		{"zero percentage", Flag{Name: "f", Type: FlagPercentage, Enabled: true}, user, false},
+		{"percentage anonymous", Flag{Name: "f", Type: FlagPercentage, Enabled: true, Percentage: 100}, FlagSubject{}, false},
+		{"targeted id", Flag{Type: FlagTargeted, Enabled: true, Users: []string{"7"}}, user, true},
+		{"targeted email", Flag{Type: FlagTargeted, Enabled: true, Users: []string{"a@example.com"}}, user, true},
+		{"targeted role", Flag{Type: FlagTargeted, Enabled: true, Roles: []string{"admin"}}, user, true},
+		{"not targeted", Flag{Type: FlagTargeted, Enabled: true, Users: []string{"8"}}, user, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.flag.Evaluate(tt.subject); got != tt.want {
+				t.Fatalf("Evaluate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagsMiddlewareResolvesSubjectLazily(t *testing.T) {
+	store := &FlagStore{flags: map[string]Flag{
+		"beta": {Name: "beta", Type: FlagTargeted, Enabled: true, Users: []string{"7"}},
+	}}
+	service := &fakeAuthService{user: &proto.User{Id: 7}}
+
+	serve := func(handler bunrouter.HandlerFunc) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		_ = NewFlagsMiddleware(store, service)(handler)(httptest.NewRecorder(), bunrouter.NewRequest(req))
+	}
+
+	serve(func(w http.ResponseWriter, req bunrouter.Request) error {
+		return nil
+	})
+	if service.validations != 0 {
+		t.Fatalf("expected no token validation without a flag lookup, got %d", service.validations)
+	}
+
+	serve(func(w http.ResponseWriter, req bunrouter.Request) error {
+		if !FlagEnabled(req.Context(), "beta") || !FlagEnabled(req.Context(), "beta") {
+			t.Fatalf("expected beta to be enabled for user 7")
+		}
+		if user, ok := UserFromContext(req.Context()); !ok || user.Id != 7 {
+			t.Fatalf("expected the authenticated user in the context")
+		}
+		return nil
+	})
+	if service.validations != 1 {
+		t.Fatalf("expected the token to be validated once, got %d", service.validations)
+	}
+}
+
+func TestPermissionMiddlewareLowercasesPermission(t *testing.T) {
+	service := &fakeAuthService{user: &proto.User{Id: 7}, matrix: map[string]bool{"gateway.manage": true}}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+
+	called := false
+	_ = NewPermissionMiddleware(service, "Gateway.manage")(func(w http.ResponseWriter, req bunrouter.Request) error {
+		called = true
+		return nil
+	})(w, bunrouter.NewRequest(req))
+
+	if !called {
+		t.Fatalf("expected Gateway.manage to match the gateway.manage matrix key, got %d", w.Code)
+	}
+}
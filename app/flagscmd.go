@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v3"
+	"strings"
+)
+
+func (app *App) flagsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "flags",
+		Usage: "manage the feature flags stored in etcd",
+		Commands: []*cli.Command{
+			app.createConfigCommand("list", "list the feature flags", func(ctx context.Context, cmd *cli.Command, h *ConfigHandler) error {
+				store, err := NewFlagStore(ctx, h.etcd)
+				if err != nil {
+					return err
+				}
+
+				for _, flag := range store.List() {
+					fmt.Println(describeFlag(flag))
+				}
+
+				return nil
+			}),
+			app.createConfigCommand("set", "create or update a feature flag", func(ctx context.Context, cmd *cli.Command, h *ConfigHandler) error {
+				flag := Flag{
+					Name:       cmd.Args().First(),
+					Type:       cmd.String("type"),
+					Enabled:    !cmd.Bool("disabled"),
+					Percentage: int(cmd.Int("percentage")),
+					Users:      cmd.StringSlice("users"),
+					Roles:      cmd.StringSlice("roles"),
+				}
+
+				if err := setFlag(ctx, h.etcd, flag); err != nil {
+					return err
+				}
+
+				fmt.Printf("flag set > %s\n", describeFlag(flag))
+				return nil
+			},
+				&cli.StringFlag{Name: "type", Value: FlagBoolean, Usage: "boolean, percentage or targeted"},
+				&cli.BoolFlag{Name: "disabled", Usage: "turn the flag off for everyone"},
+				&cli.IntFlag{Name: "percentage", Usage: "share of users the flag is on for (percentage flags)"},
+				&cli.StringSliceFlag{Name: "users", Usage: "user ids or emails the flag is on for (targeted flags)"},
+				&cli.StringSliceFlag{Name: "roles", Usage: "roles the flag is on for (targeted flags)"},
+			),
+			app.createConfigCommand("delete", "delete a feature flag", func(ctx context.Context, cmd *cli.Command, h *ConfigHandler) error {
+				name := cmd.Args().First()
+				if name == "" {
+					return errors.New("flag name is required")
+				}
+
+				if err := deleteFlag(ctx, h.etcd, name); err != nil {
+					return err
+				}
+
+				fmt.Printf("flag deleted > %s\n", name)
+				return nil
+			}),
+		},
+	}
+}
+
+func describeFlag(flag Flag) string {
+	state := "on"
+	if !flag.Enabled {
+		state = "off"
+	}
+
+	detail := ""
+	switch flag.Type {
+	case FlagPercentage:
+		detail = fmt.Sprintf(" %d%%", flag.Percentage)
+	case FlagTargeted:
+		detail = fmt.Sprintf(" users=%s roles=%s", strings.Join(flag.Users, ","), strings.Join(flag.Roles, ","))
+	}
+
+	return fmt.Sprintf("%s [%s %s]%s", flag.Name, flag.Type, state, detail)
+}
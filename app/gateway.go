@@ -0,0 +1,419 @@
+package app
+
+import (
+	"fmt"
+	"github.com/alpha-omega-corp/core/app/proto"
+	"github.com/alpha-omega-corp/core/httputils"
+	"github.com/uptrace/bunrouter"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The gateway serves the google.api.http bindings of a gRPC service over
+// HTTP. Path variables, then query parameters for the fields outside the body,
+// are set on the request message; the body is bound to the whole message
+// (body: "*") or to the named field.
+
+type gatewayBinding struct {
+	method protoreflect.MethodDescriptor
+	verb   string
+	path   string
+	body   string
+	token  string
+}
+
+type gatewayConfig struct {
+	auth        bunrouter.MiddlewareFunc
+	public      map[protoreflect.FullName]bool
+	tokens      map[protoreflect.FullName]string
+	permissions map[protoreflect.FullName]gatewayPermission
+}
+
+type gatewayPermission struct {
+	name       string
+	middleware bunrouter.MiddlewareFunc
+}
+
+type GatewayOption func(config *gatewayConfig)
+
+// GatewayAuth runs auth before every method but the public ones, given by
+// their full name such as auth.AuthService.Login.
+func GatewayAuth(auth bunrouter.MiddlewareFunc, public ...string) GatewayOption {
+	return func(config *gatewayConfig) {
+		config.auth = auth
+		for _, method := range public {
+			config.public[protoreflect.FullName(method)] = true
+		}
+	}
+}
+
+// GatewayBearerToken sets field of the requests of method to the bearer token
+// of the Authorization header, when there is one.
+func GatewayBearerToken(method string, field string) GatewayOption {
+	return func(config *gatewayConfig) {
+		config.tokens[protoreflect.FullName(method)] = field
+	}
+}
+
+// GatewayPermission only lets users holding permission, such as user.manage,
+// call methods, checked with NewPermissionMiddleware instead of the
+// GatewayAuth middleware.
+func GatewayPermission(service proto.AuthServiceClient, permission string, methods ...string) GatewayOption {
+	permission = strings.ToLower(permission)
+	middleware := NewPermissionMiddleware(service, permission)
+
+	return func(config *gatewayConfig) {
+		for _, method := range methods {
+			config.permissions[protoreflect.FullName(method)] = gatewayPermission{name: permission, middleware: middleware}
+		}
+	}
+}
+
+func newGatewayConfig(opts ...GatewayOption) *gatewayConfig {
+	config := &gatewayConfig{
+		public:      make(map[protoreflect.FullName]bool),
+		tokens:      make(map[protoreflect.FullName]string),
+		permissions: make(map[protoreflect.FullName]gatewayPermission),
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	return config
+}
+
+func (c *gatewayConfig) secured(method protoreflect.MethodDescriptor) bool {
+	if _, ok := c.permissions[method.FullName()]; ok {
+		return true
+	}
+
+	return c.auth != nil && !c.public[method.FullName()]
+}
+
+// RegisterGateway routes every annotated method of service, a fully
+// qualified name such as auth.AuthService, to conn.
+func RegisterGateway(r *Group, conn grpc.ClientConnInterface, service string, opts ...GatewayOption) error {
+	config := newGatewayConfig(opts...)
+
+	bindings, err := gatewayBindings(service)
+	if err != nil {
+		return err
+	}
+
+	secured := r
+	if config.auth != nil {
+		secured = r.Use(config.auth)
+	}
+
+	for _, binding := range bindings {
+		binding.token = config.tokens[binding.method.FullName()]
+
+		group := r
+		if permission, ok := config.permissions[binding.method.FullName()]; ok {
+			group = r.Use(permission.middleware)
+		} else if config.secured(binding.method) {
+			group = secured
+		}
+		group.Handle(binding.verb, binding.path, gatewayHandler(conn, binding))
+	}
+
+	return nil
+}
+
+func gatewayBindings(service string) ([]gatewayBinding, error) {
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("gateway service %s: %w", service, err)
+	}
+
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("gateway: %s is not a service", service)
+	}
+
+	var bindings []gatewayBinding
+	for i := 0; i < sd.Methods().Len(); i++ {
+		method := sd.Methods().Get(i)
+
+		rule, ok := protobuf.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if !ok || rule == nil {
+			continue
+		}
+
+		for _, rule := range append([]*annotations.HttpRule{rule}, rule.AdditionalBindings...) {
+			binding, err := newGatewayBinding(method, rule)
+			if err != nil {
+				return nil, err
+			}
+			bindings = append(bindings, binding)
+		}
+	}
+
+	return bindings, nil
+}
+
+func newGatewayBinding(method protoreflect.MethodDescriptor, rule *annotations.HttpRule) (gatewayBinding, error) {
+	binding := gatewayBinding{method: method, body: rule.Body}
+
+	var template string
+	switch pattern := rule.Pattern.(type) {
+	case *annotations.HttpRule_Get:
+		binding.verb, template = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Put:
+		binding.verb, template = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Post:
+		binding.verb, template = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Delete:
+		binding.verb, template = http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		binding.verb, template = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		binding.verb, template = pattern.Custom.Kind, pattern.Custom.Path
+	default:
+		return binding, fmt.Errorf("gateway %s: missing http pattern", method.FullName())
+	}
+
+	path, err := routePath(template)
+	if err != nil {
+		return binding, fmt.Errorf("gateway %s: %w", method.FullName(), err)
+	}
+	binding.path = path
+
+	return binding, nil
+}
+
+// routePath converts a path template such as /users/{id} or /files/{name=**}
+// to a bunrouter route.
+func routePath(template string) (string, error) {
+	var b strings.Builder
+
+	for len(template) > 0 {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			b.WriteString(template)
+			break
+		}
+
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable in %q", template)
+		}
+		end += start
+
+		b.WriteString(template[:start])
+
+		field, pattern, _ := strings.Cut(template[start+1:end], "=")
+		switch pattern {
+		case "", "*":
+			b.WriteString(":" + field)
+		case "**":
+			b.WriteString("*" + field)
+		default:
+			return "", fmt.Errorf("unsupported variable pattern %q", pattern)
+		}
+
+		template = template[end+1:]
+	}
+
+	return b.String(), nil
+}
+
+func gatewayHandler(conn grpc.ClientConnInterface, binding gatewayBinding) bunrouter.HandlerFunc {
+	fullMethod := fmt.Sprintf("/%s/%s", binding.method.Parent().FullName(), binding.method.Name())
+
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		in, err := newMessage(binding.method.Input())
+		if err != nil {
+			return err
+		}
+
+		if err := bindRequest(in, binding, req); err != nil {
+			httputils.Error(w, err, http.StatusBadRequest)
+			return nil
+		}
+
+		out, err := newMessage(binding.method.Output())
+		if err != nil {
+			return err
+		}
+
+		if err := conn.Invoke(req.Context(), fullMethod, in, out); err != nil {
+			httputils.Error(w, err, httpStatus(err))
+			return nil
+		}
+
+		return httputils.Render(w, req, out)
+	}
+}
+
+func newMessage(desc protoreflect.MessageDescriptor) (protobuf.Message, error) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName())
+	if err != nil {
+		return nil, err
+	}
+
+	return mt.New().Interface(), nil
+}
+
+func bindRequest(in protobuf.Message, binding gatewayBinding, req bunrouter.Request) error {
+	if binding.body != "" {
+		raw, err := io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+
+		if len(raw) > 0 {
+			target := in
+			if binding.body != "*" {
+				fd := in.ProtoReflect().Descriptor().Fields().ByName(protoreflect.Name(binding.body))
+				if fd == nil || fd.Message() == nil {
+					return fmt.Errorf("body field %s is not a message", binding.body)
+				}
+				target = in.ProtoReflect().Mutable(fd).Message().Interface()
+			}
+
+			if err := httputils.Unmarshal(req.Header.Get("Content-Type"), raw, target); err != nil {
+				return err
+			}
+		}
+	}
+
+	if binding.token != "" {
+		if token, ok := bearerToken(req.Header.Get("Authorization")); ok {
+			if err := setField(in.ProtoReflect(), binding.token, token); err != nil {
+				return err
+			}
+		}
+	}
+
+	bound := make(map[string]bool)
+	for name, value := range req.Params().Map() {
+		if err := setField(in.ProtoReflect(), name, value); err != nil {
+			return err
+		}
+		bound[name] = true
+	}
+
+	if binding.body == "*" {
+		return nil
+	}
+
+	for name, values := range req.URL.Query() {
+		if bound[name] || binding.body != "" && (name == binding.body || strings.HasPrefix(name, binding.body+".")) {
+			continue
+		}
+
+		for _, value := range values {
+			if err := setField(in.ProtoReflect(), name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// setField parses value into the field at the dotted path, appending to
+// repeated fields.
+func setField(msg protoreflect.Message, path string, value string) error {
+	names := strings.Split(path, ".")
+
+	for _, name := range names[:len(names)-1] {
+		fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil || fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("unknown field %s", path)
+		}
+		msg = msg.Mutable(fd).Message()
+	}
+
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(names[len(names)-1]))
+	if fd == nil || fd.IsMap() || (fd.Message() != nil && !fd.IsList()) {
+		return fmt.Errorf("unknown field %s", path)
+	}
+
+	v, err := parseScalar(fd, value)
+	if err != nil {
+		return fmt.Errorf("field %s: %w", path, err)
+	}
+
+	if fd.IsList() {
+		msg.Mutable(fd).List().Append(v)
+	} else {
+		msg.Set(fd, v)
+	}
+
+	return nil
+}
+
+func parseScalar(fd protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(value)), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		n, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(n)), err
+	case protoreflect.DoubleKind:
+		n, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(n), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(value)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), err
+	}
+
+	return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+}
+
+// httpStatus maps a gRPC status to the matching HTTP status code.
+func httpStatus(err error) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
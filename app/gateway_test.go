@@ -0,0 +1,249 @@
+package app
+
+import (
+	"context"
+	"github.com/alpha-omega-corp/core/app/proto"
+	"github.com/uptrace/bunrouter"
+	"google.golang.org/grpc"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoutePath(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+		err      bool
+	}{
+		{"/users", "/users", false},
+		{"/users/{id}", "/users/:id", false},
+		{"/users/{userId}/permissions", "/users/:userId/permissions", false},
+		{"/users/{id=*}", "/users/:id", false},
+		{"/files/{name=**}", "/files/*name", false},
+		{"/users/{id", "", true},
+		{"/users/{id=users/*}", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := routePath(tt.template)
+			if (err != nil) != tt.err {
+				t.Fatalf("routePath error = %v, want error %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Fatalf("routePath = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetField(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   protobuf.Message
+		path  string
+		value string
+		want  protobuf.Message
+		err   bool
+	}{
+		{"int", &proto.GetUserRequest{}, "id", "7", &proto.GetUserRequest{Id: 7}, false},
+		{"string", &proto.UpdateUserRequest{}, "name", "ada", &proto.UpdateUserRequest{Name: "ada"}, false},
+		{"bool", &proto.CreateServicePermissionsRequest{}, "canRead", "true", &proto.CreateServicePermissionsRequest{CanRead: true}, false},
+		{"repeated", &proto.UpdateUserRequest{Roles: []int64{1}}, "roles", "2", &proto.UpdateUserRequest{Roles: []int64{1, 2}}, false},
+		{"nested", &proto.GetUserResponse{}, "user.name", "ada", &proto.GetUserResponse{User: &proto.User{Name: "ada"}}, false},
+		{"invalid int", &proto.GetUserRequest{}, "id", "seven", nil, true},
+		{"unknown field", &proto.GetUserRequest{}, "email", "ada@example.com", nil, true},
+		{"message field", &proto.GetUserResponse{}, "user", "ada", nil, true},
+		{"through repeated", &proto.User{}, "roles.name", "admin", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setField(tt.msg.ProtoReflect(), tt.path, tt.value)
+			if (err != nil) != tt.err {
+				t.Fatalf("setField error = %v, want error %v", err, tt.err)
+			}
+			if tt.want != nil && !protobuf.Equal(tt.msg, tt.want) {
+				t.Fatalf("message = %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+// testBinding returns the gateway binding of an auth.AuthService method.
+func testBinding(t *testing.T, method string) gatewayBinding {
+	t.Helper()
+
+	bindings, err := gatewayBindings("auth.AuthService")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, binding := range bindings {
+		if binding.method.Name() == protoreflect.Name(method) {
+			return binding
+		}
+	}
+
+	t.Fatalf("no binding for %s", method)
+	return gatewayBinding{}
+}
+
+func TestBindRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		target string
+		body   string
+		header string
+		want   protobuf.Message
+		err    bool
+	}{
+		{"path", "GetUser", "", "/users/7", "", "", &proto.GetUserRequest{Id: 7}, false},
+		{"query", "GetUserPermissions", "", "/users/7/permissions?userId=8", "", "", &proto.GetUserPermissionsRequest{UserId: 7}, false},
+		{"body", "CreateUser", "", "/users", `{"email":"ada@example.com","name":"ada"}`, "", &proto.CreateUserRequest{Email: "ada@example.com", Name: "ada"}, false},
+		{"body and path", "UpdateUser", "", "/users/7", `{"id":8,"name":"ada","roles":[1]}`, "", &proto.UpdateUserRequest{Id: 7, Name: "ada", Roles: []int64{1}}, false},
+		{"body ignores query", "UpdateUser", "", "/users/7?name=bob", `{"name":"ada"}`, "", &proto.UpdateUserRequest{Id: 7, Name: "ada"}, false},
+		{"bearer token", "Validate", "token", "/auth/validate", "", "Bearer secret", &proto.ValidateRequest{Token: "secret"}, false},
+		{"bearer token over body", "Validate", "token", "/auth/validate", `{"token":"body"}`, "Bearer secret", &proto.ValidateRequest{Token: "secret"}, false},
+		{"token without header", "Validate", "token", "/auth/validate", `{"token":"body"}`, "", &proto.ValidateRequest{Token: "body"}, false},
+		{"invalid path", "GetUser", "", "/users/seven", "", "", nil, true},
+		{"invalid body", "CreateUser", "", "/users", `{"email":`, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binding := testBinding(t, tt.method)
+			binding.token = tt.token
+
+			in, err := newMessage(binding.method.Input())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var bindErr error
+			r := bunrouter.New()
+			r.Handle(binding.verb, binding.path, func(w http.ResponseWriter, req bunrouter.Request) error {
+				bindErr = bindRequest(in, binding, req)
+				return nil
+			})
+
+			req := httptest.NewRequest(binding.verb, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if (bindErr != nil) != tt.err {
+				t.Fatalf("bindRequest error = %v, want error %v", bindErr, tt.err)
+			}
+			if tt.want != nil && !protobuf.Equal(in, tt.want) {
+				t.Fatalf("request = %v, want %v", in, tt.want)
+			}
+		})
+	}
+}
+
+// recordingConn records the methods invoked through the gateway.
+type recordingConn struct {
+	grpc.ClientConnInterface
+	methods []string
+}
+
+func (c *recordingConn) Invoke(_ context.Context, method string, _ any, _ any, _ ...grpc.CallOption) error {
+	c.methods = append(c.methods, method)
+	return nil
+}
+
+func TestRegisterGatewayAuth(t *testing.T) {
+	r := NewRouter()
+	conn := &recordingConn{}
+	deny := func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			w.WriteHeader(http.StatusUnauthorized)
+			return nil
+		}
+	}
+
+	if err := RegisterGateway(r.Group, conn, "auth.AuthService", GatewayAuth(deny, "auth.AuthService.Login")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		target string
+		status int
+	}{
+		{http.MethodPost, "/auth/login", http.StatusOK},
+		{http.MethodGet, "/users", http.StatusUnauthorized},
+		{http.MethodDelete, "/users/7", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader("{}")))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+
+	if len(conn.methods) != 1 || conn.methods[0] != "/auth.AuthService/Login" {
+		t.Fatalf("invoked %v, want only the public method", conn.methods)
+	}
+}
+
+func TestRegisterGatewayPermission(t *testing.T) {
+	pass := func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc { return next }
+
+	tests := []struct {
+		name   string
+		matrix map[string]bool
+		token  bool
+		method string
+		target string
+		status int
+	}{
+		{"registered user assigns a role", nil, true, http.MethodPost, "/users/roles", http.StatusForbidden},
+		{"registered user creates a user", nil, true, http.MethodPost, "/users", http.StatusForbidden},
+		{"registered user lists users", nil, true, http.MethodGet, "/users", http.StatusOK},
+		{"writer creates a user", map[string]bool{"user.write": true}, true, http.MethodPost, "/users", http.StatusOK},
+		{"writer assigns a role", map[string]bool{"user.write": true}, true, http.MethodPost, "/users/roles", http.StatusForbidden},
+		{"writer updates roles", map[string]bool{"user.write": true}, true, http.MethodPut, "/users/7", http.StatusForbidden},
+		{"manager assigns a role", map[string]bool{"user.manage": true}, true, http.MethodPost, "/users/roles", http.StatusOK},
+		{"anonymous assigns a role", nil, false, http.MethodPost, "/users/roles", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &fakeAuthService{user: &proto.User{Id: 7}, matrix: tt.matrix}
+			r := NewRouter()
+			err := RegisterGateway(r.Group, &recordingConn{}, "auth.AuthService",
+				GatewayAuth(pass),
+				GatewayPermission(service, "user.write", "auth.AuthService.CreateUser", "auth.AuthService.DeleteUser"),
+				GatewayPermission(service, "User.Manage", "auth.AuthService.UpdateUser", "auth.AuthService.AssignRole"),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader("{}"))
+			if tt.token {
+				req.Header.Set("Authorization", "Bearer token")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
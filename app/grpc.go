@@ -1,15 +1,24 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"github.com/uptrace/bun"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
 	"log"
+	"log/slog"
 	"net"
+	"os"
+	"sort"
+	"strconv"
 )
 
-func GRPC(configHandler ConfigHandler, dbHandler *StorageHandler, init func(db *bun.DB, grpc *grpc.Server)) error {
-	config := configHandler.config
+// GRPC serves until lifecycle shuts down, when the server leaves the registry
+// and finishes the calls in flight.
+func GRPC(lifecycle *Lifecycle, configHandler *ConfigHandler, dbHandler *StorageHandler, init func(db *bun.DB, grpc *grpc.Server)) error {
+	config := configHandler.GetConfig()
 
 	listen, err := net.Listen("tcp", *config.Url)
 
@@ -17,31 +26,164 @@ func GRPC(configHandler ConfigHandler, dbHandler *StorageHandler, init func(db *
 		return err
 	}
 
-	srv := grpc.NewServer()
-	if dbHandler != nil {
-		db := dbHandler.Database()
-		defer func(db *bun.DB) {
-			err := db.Close()
-			if err != nil {
-				log.Fatal(err)
-			}
-		}(db)
+	creds, err := serverCredentials(config.Grpc.TLS)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer(
+		creds,
+		grpc.ChainUnaryInterceptor(identityUnaryInterceptor, readYourWritesUnaryInterceptor, configRevisionUnaryInterceptor(configHandler)),
+		grpc.ChainStreamInterceptor(identityStreamInterceptor, readYourWritesStreamInterceptor, configRevisionStreamInterceptor(configHandler)),
+	)
+	lifecycle.Health().registerGRPC(srv)
+	lifecycle.Catalog().addGRPC(srv)
+	if config.Grpc.Reflection {
+		reflection.Register(srv)
+	}
 
-		init(db, srv)
+	if dbHandler != nil {
+		init(dbHandler.Database(), srv)
 	} else {
 		init(nil, srv)
 	}
 
+	var registration *Registration
+	if configHandler.etcd != nil {
+		registration = Register(configHandler.etcd, configHandler.name, advertiseAddr(config, listen.Addr()))
+	}
+
+	lifecycle.OnStop(func(ctx context.Context) error {
+		if registration != nil {
+			if err := registration.Deregister(ctx); err != nil {
+				slog.Warn("service deregistration error", "service", configHandler.name, "error", err)
+			}
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			srv.Stop()
+			return fmt.Errorf("grpc %s: %w", configHandler.name, ctx.Err())
+		}
+	})
+
 	fmt.Printf("running at tcp://%v", *config.Url)
 	return srv.Serve(listen)
 }
 
+// ConfigRevisionHeader is the gRPC response header carrying the etcd revision
+// of the configuration the server was running with.
+const ConfigRevisionHeader = "x-config-revision"
+
+func configRevisionHeader(configHandler *ConfigHandler) metadata.MD {
+	return metadata.Pairs(ConfigRevisionHeader, strconv.FormatInt(configHandler.GetConfig().Revision(), 10))
+}
+
+func configRevisionUnaryInterceptor(configHandler *ConfigHandler) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := grpc.SetHeader(ctx, configRevisionHeader(configHandler)); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func configRevisionStreamInterceptor(configHandler *ConfigHandler) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := ss.SetHeader(configRevisionHeader(configHandler)); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// NewClient connects straight to the address in c.Url, with the TLS settings
+// of c. Use NewServiceClient to reach a service through the registry.
 func NewClient[T any](c *Config, proto func(conn grpc.ClientConnInterface) T) T {
-	conn, err := grpc.NewClient(*c.Url, grpc.WithInsecure())
+	conn, err := dialService(c, "passthrough:///"+*c.Url)
+	if err != nil {
+		log.Fatalf("grpc client for %s: %v", *c.Url, err)
+	}
 
+	return proto(conn)
+}
+
+// NewServiceClient connects to the registered instances of the named service,
+// balancing calls between them.
+func NewServiceClient[T any](configHandler *ConfigHandler, name string, proto func(conn grpc.ClientConnInterface) T) T {
+	conn, err := newClientConn(configHandler, name)
 	if err != nil {
-		fmt.Printf("Could not connect to %v: %v", *c.Url, err)
+		log.Fatalf("grpc client for %s: %v", name, err)
 	}
 
 	return proto(conn)
 }
+
+// serviceNames lists the services registered on srv, sorted.
+func serviceNames(srv *grpc.Server) []string {
+	var names []string
+	for name := range srv.GetServiceInfo() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// newClientConn dials the address set under services.<name> when there is
+// one, or the instances registered in etcd.
+func newClientConn(configHandler *ConfigHandler, name string) (*grpc.ClientConn, error) {
+	if addr := configHandler.GetConfig().Env.GetString("services." + name); addr != "" {
+		return dialService(configHandler.GetConfig(), "passthrough:///"+addr)
+	}
+
+	if configHandler.etcd == nil {
+		return nil, fmt.Errorf("etcd is not connected to resolve %s, set services.%s to its address", name, name)
+	}
+
+	return dialService(configHandler.GetConfig(), registryScheme+":///"+name, grpc.WithResolvers(NewEtcdResolver(configHandler.etcd)))
+}
+
+func dialService(config *Config, target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	creds, err := clientCredentials(config.Grpc.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc.NewClient(target, append([]grpc.DialOption{
+		creds,
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin": {}}]}`),
+	}, opts...)...)
+}
+
+// advertiseAddr is the address other services reach this one at: the
+// advertise_url setting, or the listen address with the hostname filling in
+// an unspecified host.
+func advertiseAddr(config *Config, listen net.Addr) string {
+	if addr := config.Env.GetString("advertise_url"); addr != "" {
+		return addr
+	}
+
+	host, port, err := net.SplitHostPort(listen.String())
+	if err != nil {
+		return listen.String()
+	}
+
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		if hostname, err := os.Hostname(); err == nil {
+			host = hostname
+		}
+	}
+
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+type headerStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestConfigRevisionHeader(t *testing.T) {
+	h := newStaticConfigHandler("test", &Config{revision: 42}, nil)
+	stream := &headerStream{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+
+	_, err := configRevisionUnaryInterceptor(h)(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req any) (any, error) {
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+
+	if got := stream.header.Get(ConfigRevisionHeader); len(got) != 1 || got[0] != "42" {
+		t.Fatalf("%s = %v, want [42]", ConfigRevisionHeader, got)
+	}
+}
+
+func TestNewClientConnWithoutEtcd(t *testing.T) {
+	h := newTestConfigHandler("")
+	config, err := h.resolve(nil)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	h.config.Store(config)
+
+	if _, err := newClientConn(h, "user"); err == nil {
+		t.Fatalf("expected an error without etcd or a static address")
+	}
+
+	config.Env.Set("services.user", "localhost:50051")
+	conn, err := newClientConn(h, "user")
+	if err != nil {
+		t.Fatalf("newClientConn: %v", err)
+	}
+	defer conn.Close()
+
+	if got := conn.Target(); got != "passthrough:///localhost:50051" {
+		t.Fatalf("target = %q, want the static address", got)
+	}
+}
+
+func TestNewClientDialsUrl(t *testing.T) {
+	url := "localhost:50051"
+
+	conn := NewClient(&Config{Url: &url}, func(conn grpc.ClientConnInterface) *grpc.ClientConn {
+		return conn.(*grpc.ClientConn)
+	})
+	defer conn.Close()
+
+	if got := conn.Target(); got != "passthrough:///localhost:50051" {
+		t.Fatalf("target = %q, want the configured url", got)
+	}
+}
@@ -0,0 +1,345 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// gRPC TLS modes: off serves plaintext, tls encrypts with the server
+// certificate and mtls also requires clients to present a certificate signed
+// by the configured CA. Certificates are read again when their files change.
+const (
+	GRPCTLSOff    = "off"
+	GRPCTLSServer = "tls"
+	GRPCTLSMutual = "mtls"
+)
+
+type GRPCConfig struct {
+	TLS        GRPCTLSConfig `mapstructure:"tls"`
+	Reflection bool          `mapstructure:"reflection"`
+}
+
+type GRPCTLSConfig struct {
+	Mode       string `mapstructure:"mode" validate:"omitempty,oneof=off tls mtls"`
+	CAFile     string `mapstructure:"ca_file"`
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+	ServerName string `mapstructure:"server_name"`
+}
+
+func (c GRPCTLSConfig) enabled() bool {
+	return c.Mode != "" && c.Mode != GRPCTLSOff
+}
+
+// certReloader serves the certificate and CA pool read from disk, reading
+// them again at most once per second when a file was modified.
+type certReloader struct {
+	config GRPCTLSConfig
+
+	mu        sync.Mutex
+	checked   time.Time
+	modified  map[string]time.Time
+	cert      *tls.Certificate
+	roots     *x509.CertPool
+	hasClient bool
+}
+
+func newCertReloader(config GRPCTLSConfig) (*certReloader, error) {
+	r := &certReloader{
+		config:   config,
+		modified: make(map[string]time.Time),
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	if r.config.CertFile != "" || r.config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load grpc certificate: %w", err)
+		}
+		r.cert = &cert
+	}
+
+	if r.config.CAFile != "" {
+		rawCA, err := os.ReadFile(r.config.CAFile)
+		if err != nil {
+			return fmt.Errorf("read grpc CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(rawCA) {
+			return errors.New("grpc CA file contains no certificates")
+		}
+		r.roots = pool
+	}
+
+	for _, file := range []string{r.config.CertFile, r.config.KeyFile, r.config.CAFile} {
+		if info, err := os.Stat(file); err == nil {
+			r.modified[file] = info.ModTime()
+		}
+	}
+
+	return nil
+}
+
+func (r *certReloader) refresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < time.Second {
+		return
+	}
+	r.checked = time.Now()
+
+	changed := false
+	for file, modified := range r.modified {
+		if info, err := os.Stat(file); err == nil && !info.ModTime().Equal(modified) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := r.load(); err != nil {
+		slog.Warn("keeping previous grpc certificates", "error", err)
+		return
+	}
+
+	fmt.Printf("grpc certificates reloaded > %s\n", r.config.CertFile)
+}
+
+func (r *certReloader) certificate() (*tls.Certificate, error) {
+	r.refresh()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert == nil {
+		return nil, errors.New("no grpc certificate configured")
+	}
+
+	return r.cert, nil
+}
+
+func (r *certReloader) pool() *x509.CertPool {
+	r.refresh()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.roots
+}
+
+func serverCredentials(c GRPCTLSConfig) (grpc.ServerOption, error) {
+	if !c.enabled() {
+		return grpc.Creds(insecure.NewCredentials()), nil
+	}
+
+	if c.Mode != GRPCTLSServer && c.Mode != GRPCTLSMutual {
+		return nil, fmt.Errorf("unsupported grpc tls mode: %s", c.Mode)
+	}
+
+	if c.Mode == GRPCTLSMutual && c.CAFile == "" {
+		return nil, errors.New("grpc mtls requires a ca_file to verify clients")
+	}
+
+	certs, err := newCertReloader(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := certs.certificate(); err != nil {
+		return nil, err
+	}
+
+	return grpc.Creds(credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, err := certs.certificate()
+			if err != nil {
+				return nil, err
+			}
+
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   []string{"h2"},
+				Certificates: []tls.Certificate{*cert},
+			}
+
+			if c.Mode == GRPCTLSMutual {
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+				config.ClientCAs = certs.pool()
+			}
+
+			return config, nil
+		},
+	})), nil
+}
+
+// clientCredentials verifies the server against the configured CA, or the
+// system roots without one. The server name defaults to the host of the dial
+// target, the service name for registry targets, so service certificates
+// carry it as a DNS name, and servers dialed by IP carry it as an IP address.
+func clientCredentials(c GRPCTLSConfig) (grpc.DialOption, error) {
+	if !c.enabled() {
+		return grpc.WithTransportCredentials(insecure.NewCredentials()), nil
+	}
+
+	creds, err := clientTransportCredentials(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc.WithTransportCredentials(creds), nil
+}
+
+func clientTransportCredentials(c GRPCTLSConfig) (credentials.TransportCredentials, error) {
+	certs, err := newCertReloader(c)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.Mode == GRPCTLSMutual {
+		if _, err := certs.certificate(); err != nil {
+			return nil, err
+		}
+
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certs.certificate()
+		}
+	}
+
+	if c.CAFile == "" {
+		return credentials.NewTLS(config), nil
+	}
+
+	return &caCredentials{TransportCredentials: credentials.NewTLS(config), config: config, certs: certs}, nil
+}
+
+// caCredentials verifies servers against the current CA pool rather than a
+// copy taken at dial time, checking the certificate against the configured
+// server name or the host of the dial target.
+type caCredentials struct {
+	credentials.TransportCredentials
+	config *tls.Config
+	certs  *certReloader
+}
+
+func (c *caCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	host := c.config.ServerName
+	if host == "" {
+		host = authority
+		if h, _, err := net.SplitHostPort(authority); err == nil {
+			host = h
+		}
+	}
+
+	config := c.config.Clone()
+	config.ServerName = host
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		return verifyServer(state, host, c.certs.pool())
+	}
+
+	return credentials.NewTLS(config).ClientHandshake(ctx, authority, conn)
+}
+
+func (c *caCredentials) Clone() credentials.TransportCredentials {
+	return &caCredentials{TransportCredentials: c.TransportCredentials.Clone(), config: c.config.Clone(), certs: c.certs}
+}
+
+// verifyServer checks the certificate chain the server sent against roots and
+// its leaf against host, a DNS name or an IP address.
+func verifyServer(state tls.ConnectionState, host string, roots *x509.CertPool) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("grpc server sent no certificates")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	leaf := state.PeerCertificates[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		return err
+	}
+
+	if host == "" {
+		return errors.New("grpc server name is unknown, set grpc.tls.server_name")
+	}
+
+	return leaf.VerifyHostname(host)
+}
+
+type serviceIdentityKey struct{}
+
+// ServiceIdentity returns the name of the calling service, taken from its
+// verified client certificate under mtls.
+func ServiceIdentity(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(serviceIdentityKey{}).(string)
+	return identity, ok
+}
+
+func peerIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+
+	return cert.Subject.CommonName
+}
+
+func withServiceIdentity(ctx context.Context) context.Context {
+	if identity := peerIdentity(ctx); identity != "" {
+		return context.WithValue(ctx, serviceIdentityKey{}, identity)
+	}
+
+	return ctx
+}
+
+func identityUnaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(withServiceIdentity(ctx), req)
+}
+
+func identityStreamInterceptor(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: ss, ctx: withServiceIdentity(ss.Context())})
+}
@@ -0,0 +1,264 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCert creates a certificate for names, DNS names or IP addresses,
+// signed by parent or self-signed as a CA without one.
+func newTestCert(t *testing.T, parent *testCert, names ...string) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write stores the certificate and its key as PEM files in dir.
+func (c *testCert) write(t *testing.T, dir string, name string) (string, string) {
+	t.Helper()
+
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestVerifyServer(t *testing.T) {
+	ca := newTestCert(t, nil)
+	other := newTestCert(t, nil)
+	leaf := newTestCert(t, ca, "user", "127.0.0.1")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	tests := []struct {
+		name  string
+		certs []*x509.Certificate
+		host  string
+		err   bool
+	}{
+		{"dns name", []*x509.Certificate{leaf.cert}, "user", false},
+		{"ip address", []*x509.Certificate{leaf.cert}, "127.0.0.1", false},
+		{"other dns name", []*x509.Certificate{leaf.cert}, "auth", true},
+		{"other ip address", []*x509.Certificate{leaf.cert}, "10.0.0.1", true},
+		{"empty host", []*x509.Certificate{leaf.cert}, "", true},
+		{"untrusted", []*x509.Certificate{newTestCert(t, other, "user").cert}, "user", true},
+		{"no certificates", nil, "user", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyServer(tls.ConnectionState{PeerCertificates: tt.certs}, tt.host, roots)
+			if (err != nil) != tt.err {
+				t.Fatalf("verifyServer error = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestClientCredentialsDialTarget(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, nil)
+	caFile, _ := ca.write(t, dir, "ca")
+
+	tests := []struct {
+		name       string
+		names      []string
+		serverName string
+		authority  string
+		err        bool
+	}{
+		{"ip target", []string{"127.0.0.1"}, "", "127.0.0.1:50051", false},
+		{"ip target without ip", []string{"user"}, "", "127.0.0.1:50051", true},
+		{"service target", []string{"user"}, "", "user", false},
+		{"server name", []string{"user"}, "user", "127.0.0.1:50051", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leaf := newTestCert(t, ca, tt.names...)
+			creds, err := clientTransportCredentials(GRPCTLSConfig{Mode: GRPCTLSServer, CAFile: caFile, ServerName: tt.serverName})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+
+			go func() {
+				server, err := listener.Accept()
+				if err != nil {
+					return
+				}
+
+				conn := tls.Server(server, &tls.Config{
+					Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.der}, PrivateKey: leaf.key}},
+					NextProtos:   []string{"h2"},
+				})
+				_ = conn.Handshake()
+				conn.Close()
+			}()
+
+			client, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, _, err = creds.ClientHandshake(ctx, tt.authority, client)
+			if (err != nil) != tt.err {
+				t.Fatalf("handshake error = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, nil)
+	first := newTestCert(t, ca, "user")
+	certFile, keyFile := first.write(t, dir, "server")
+
+	r, err := newCertReloader(GRPCTLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := func() []byte {
+		t.Helper()
+
+		// Skip the once per second throttle.
+		r.mu.Lock()
+		r.checked = time.Time{}
+		r.mu.Unlock()
+
+		cert, err := r.certificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Certificate[0]
+	}
+
+	if !first.cert.Equal(mustParse(t, current())) {
+		t.Fatalf("expected the first certificate")
+	}
+
+	second := newTestCert(t, ca, "user")
+	second.write(t, dir, "server")
+	touch(t, certFile, keyFile)
+
+	if !second.cert.Equal(mustParse(t, current())) {
+		t.Fatalf("expected the reloaded certificate")
+	}
+
+	if err := os.WriteFile(certFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, certFile)
+
+	if !second.cert.Equal(mustParse(t, current())) {
+		t.Fatalf("expected the previous certificate to be kept after an invalid update")
+	}
+}
+
+func mustParse(t *testing.T, der []byte) *x509.Certificate {
+	t.Helper()
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// touch moves the modification time of files forward, file systems may not
+// record sub-second changes.
+func touch(t *testing.T, files ...string) {
+	t.Helper()
+
+	modified := time.Now().Add(time.Minute)
+	for _, file := range files {
+		if err := os.Chtimes(file, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bunrouter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Health runs the readiness checks of an application. Liveness only reports
+// that the process serves requests; readiness also requires every check to
+// pass and turns false as soon as the shutdown starts.
+const (
+	healthTimeout  = 2 * time.Second
+	healthInterval = 10 * time.Second
+)
+
+type HealthCheck func(ctx context.Context) error
+
+type Health struct {
+	lifecycle *Lifecycle
+
+	mu      sync.Mutex
+	checks  map[string]registeredCheck
+	servers []*health.Server
+}
+
+type registeredCheck struct {
+	check      HealthCheck
+	dependency bool
+	optional   bool
+}
+
+type HealthReport struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func newHealth(lifecycle *Lifecycle) *Health {
+	return &Health{
+		lifecycle: lifecycle,
+		checks:    make(map[string]registeredCheck),
+	}
+}
+
+// AddCheck registers a readiness check, replacing any check of the same name.
+func (h *Health) AddCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks[name] = registeredCheck{check: check}
+}
+
+// AddDependency registers a check of a downstream service. It is part of
+// /readyz but not of the gRPC health status, which would otherwise depend on
+// itself when a process hosts the service it calls.
+func (h *Health) AddDependency(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks[name] = registeredCheck{check: check, dependency: true}
+}
+
+// AddOptionalCheck registers a check reported by /readyz that never fails
+// readiness, for a service the application keeps working without.
+func (h *Health) AddOptionalCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks[name] = registeredCheck{check: check, optional: true}
+}
+
+// Ready runs every check concurrently and reports their results.
+func (h *Health) Ready(ctx context.Context) (bool, HealthReport) {
+	return h.ready(ctx, true)
+}
+
+func (h *Health) ready(ctx context.Context, dependencies bool) (bool, HealthReport) {
+	if h.lifecycle.Stopping() {
+		return false, HealthReport{Status: "shutting down"}
+	}
+
+	h.mu.Lock()
+	names := make([]string, 0, len(h.checks))
+	checks := make(map[string]registeredCheck, len(h.checks))
+	for name, registered := range h.checks {
+		if (registered.dependency || registered.optional) && !dependencies {
+			continue
+		}
+
+		names = append(names, name)
+		checks[name] = registered
+	}
+	h.mu.Unlock()
+	sort.Strings(names)
+
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+			errs[i] = check(ctx)
+		}(i, checks[name].check)
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: "ok", Checks: make(map[string]string, len(names))}
+	for i, name := range names {
+		report.Checks[name] = "ok"
+		if errs[i] != nil {
+			report.Checks[name] = errs[i].Error()
+			if !checks[name].optional {
+				report.Status = "not ready"
+			}
+		}
+	}
+
+	return report.Status == "ok", report
+}
+
+// registerGRPC serves grpc.health.v1 on srv, updating the overall status
+// from the checks until the shutdown.
+func (h *Health) registerGRPC(srv *grpc.Server) {
+	server := health.NewServer()
+	healthpb.RegisterHealthServer(srv, server)
+
+	h.mu.Lock()
+	h.servers = append(h.servers, server)
+	h.mu.Unlock()
+
+	h.update(server)
+	go func() {
+		ticker := time.NewTicker(healthInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				h.update(server)
+			case <-h.lifecycle.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (h *Health) update(server *health.Server) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if ready, _ := h.ready(context.Background(), false); ready {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+
+	server.SetServingStatus("", status)
+}
+
+// shutdown reports every gRPC server as not serving.
+func (h *Health) shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, server := range h.servers {
+		server.Shutdown()
+	}
+}
+
+// registerRoutes adds the /healthz liveness and /readyz readiness routes.
+func (h *Health) registerRoutes(r *Router) {
+	r.GET("/healthz", func(w http.ResponseWriter, req bunrouter.Request) error {
+		return bunrouter.JSON(w, HealthReport{Status: "ok"})
+	})
+
+	r.GET("/readyz", func(w http.ResponseWriter, req bunrouter.Request) error {
+		ready, report := h.Ready(req.Context())
+		if !ready {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		return bunrouter.JSON(w, report)
+	})
+}
+
+// GRPCHealthCheck checks service, or the whole server when empty, through
+// the grpc.health.v1 service of conn.
+func GRPCHealthCheck(conn grpc.ClientConnInterface, service string) HealthCheck {
+	client := healthpb.NewHealthClient(conn)
+
+	return func(ctx context.Context) error {
+		res, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+
+		if res.Status != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("status %s", res.Status)
+		}
+
+		return nil
+	}
+}
+
+// Ping checks the primary database answers.
+func (h *StorageHandler) Ping(ctx context.Context) error {
+	return h.Database().PingContext(ctx)
+}
+
+// Ping checks the etcd endpoint answers.
+func (h *ConfigHandler) Ping(ctx context.Context) error {
+	if h.etcd == nil {
+		return errors.New("etcd is not connected")
+	}
+
+	for _, endpoint := range h.etcd.Endpoints() {
+		if _, err := h.etcd.Status(ctx, endpoint); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHealthReady(t *testing.T) {
+	failing := func(context.Context) error { return errors.New("down") }
+	passing := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name     string
+		register func(h *Health)
+		ready    bool
+		grpc     bool
+	}{
+		{"no check", func(h *Health) {}, true, true},
+		{"passing", func(h *Health) { h.AddCheck("postgres", passing) }, true, true},
+		{"failing", func(h *Health) { h.AddCheck("postgres", failing) }, false, false},
+		{"failing dependency", func(h *Health) { h.AddDependency("user", failing) }, false, true},
+		{"failing optional", func(h *Health) { h.AddOptionalCheck("etcd", failing) }, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewLifecycle().Health()
+			tt.register(h)
+
+			ready, report := h.Ready(context.Background())
+			if ready != tt.ready {
+				t.Fatalf("ready = %v, want %v (%+v)", ready, tt.ready, report)
+			}
+
+			if grpc, _ := h.ready(context.Background(), false); grpc != tt.grpc {
+				t.Fatalf("grpc ready = %v, want %v", grpc, tt.grpc)
+			}
+		})
+	}
+}
+
+func TestHealthReportsOptionalFailure(t *testing.T) {
+	h := NewLifecycle().Health()
+	h.AddOptionalCheck("etcd", func(context.Context) error { return errors.New("down") })
+
+	_, report := h.Ready(context.Background())
+	if report.Status != "ok" || report.Checks["etcd"] != "down" {
+		t.Fatalf("report = %+v, want ok with the etcd error", report)
+	}
+}
+
+func TestHealthNotReadyWhileStopping(t *testing.T) {
+	lifecycle := NewLifecycle()
+	lifecycle.stopping.Store(true)
+
+	if ready, _ := lifecycle.Health().Ready(context.Background()); ready {
+		t.Fatalf("expected not ready once the shutdown started")
+	}
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v3"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"os"
+)
+
+// Every write to a configuration key creates an etcd revision. The history is
+// walked back from the latest value, one ModRevision at a time, until the key
+// was created or the older revisions were compacted.
+
+type ConfigRevision struct {
+	Revision int64
+	Version  int64
+	Value    []byte
+}
+
+// configHistory lists the stored revisions of name, newest first. compacted
+// reports whether older revisions are no longer available.
+func configHistory(ctx context.Context, etcd *clientv3.Client, name string) (revisions []ConfigRevision, compacted bool, err error) {
+	kv, err := getRemoteValue(ctx, etcd, name, 0)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for {
+		revisions = append(revisions, ConfigRevision{
+			Revision: kv.ModRevision,
+			Version:  kv.Version,
+			Value:    kv.Value,
+		})
+
+		if kv.ModRevision <= kv.CreateRevision {
+			return revisions, false, nil
+		}
+
+		kv, err = getRemoteValue(ctx, etcd, name, kv.ModRevision-1)
+		if errors.Is(err, rpctypes.ErrCompacted) {
+			return revisions, true, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// rollbackConfig writes the value name had at rev as its latest value, unless
+// the key was modified concurrently.
+func rollbackConfig(ctx context.Context, etcd *clientv3.Client, name string, rev int64) (int64, error) {
+	current, err := getRemoteValue(ctx, etcd, name, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	previous, err := getRemoteRevision(ctx, etcd, name, rev)
+	if err != nil {
+		return 0, err
+	}
+
+	key := configKey(name)
+	res, err := etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", current.ModRevision)).
+		Then(clientv3.OpPut(key, string(previous.Value))).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	if !res.Succeeded {
+		return 0, fmt.Errorf("%s was modified during the rollback, try again", key)
+	}
+
+	return res.Header.Revision, nil
+}
+
+// getRemoteRevision reads name at rev and checks the value was written at
+// that revision rather than merely current at the time.
+func getRemoteRevision(ctx context.Context, etcd *clientv3.Client, name string, rev int64) (*mvccpb.KeyValue, error) {
+	kv, err := getRemoteValue(ctx, etcd, name, rev)
+	if errors.Is(err, rpctypes.ErrCompacted) {
+		return nil, fmt.Errorf("revision %d of %s has been compacted", rev, configKey(name))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if kv.ModRevision != rev {
+		return nil, fmt.Errorf("%s was not written at revision %d, see config history", configKey(name), rev)
+	}
+
+	return kv, nil
+}
+
+func (app *App) configHistoryCommands() []*cli.Command {
+	revFlag := &cli.Int64Flag{
+		Name:     "rev",
+		Usage:    "etcd revision of the configuration",
+		Required: true,
+	}
+
+	return []*cli.Command{
+		app.createConfigCommand("history", "list the stored revisions of an application configuration", func(ctx context.Context, cmd *cli.Command, h *ConfigHandler) error {
+			name := app.configTarget(cmd)
+
+			revisions, compacted, err := configHistory(ctx, h.etcd, name)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%-10s %-8s %s\n", "REVISION", "VERSION", "SIZE")
+			for _, revision := range revisions {
+				fmt.Printf("%-10d %-8d %d bytes\n", revision.Revision, revision.Version, len(revision.Value))
+			}
+
+			if compacted {
+				fmt.Println("older revisions have been compacted")
+			}
+
+			return nil
+		}),
+		app.createConfigCommand("show", "print an application configuration as it was at a revision", func(ctx context.Context, cmd *cli.Command, h *ConfigHandler) error {
+			kv, err := getRemoteRevision(ctx, h.etcd, app.configTarget(cmd), cmd.Int64("rev"))
+			if err != nil {
+				return err
+			}
+
+			value := kv.Value
+			if !cmd.Bool("reveal") {
+				if value, err = RedactConfig(value); err != nil {
+					return err
+				}
+			}
+
+			_, err = os.Stdout.Write(value)
+			return err
+		}, revFlag, &cli.BoolFlag{
+			Name:  "reveal",
+			Usage: "print secrets instead of redacting them",
+		}),
+		app.createConfigCommand("rollback", "restore an application configuration to a previous revision", func(ctx context.Context, cmd *cli.Command, h *ConfigHandler) error {
+			name := app.configTarget(cmd)
+
+			revision, err := rollbackConfig(ctx, h.etcd, name, cmd.Int64("rev"))
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("config rolled back > %s to revision %d (revision %d)\n", configKey(name), cmd.Int64("rev"), revision)
+			return nil
+		}, revFlag),
+	}
+}
+
+// configTarget is the application named by the first argument, defaulting to
+// this application.
+func (app *App) configTarget(cmd *cli.Command) string {
+	if name := cmd.Args().First(); name != "" {
+		return name
+	}
+
+	return app.name
+}
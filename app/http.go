@@ -1,18 +1,22 @@
 package app
 
 import (
+	"errors"
 	"fmt"
+	"github.com/alpha-omega-corp/core/httputils"
 	"github.com/uptrace/bunrouter"
 	"github.com/uptrace/bunrouter/extra/bunrouterotel"
 	"github.com/uptrace/bunrouter/extra/reqlog"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 )
 
-func HTTP(configHandler ConfigHandler, init func(router *bunrouter.Router)) {
-	r := bunrouter.New(
+// HTTP serves the routes registered by init until lifecycle shuts down.
+// middlewares run for every route, after request logging and tracing.
+func HTTP(lifecycle *Lifecycle, configHandler *ConfigHandler, init func(router *Router), middlewares ...bunrouter.MiddlewareFunc) {
+	r := NewRouter(
 		bunrouter.WithMiddleware(reqlog.NewMiddleware(
 			reqlog.WithEnabled(true),
 			reqlog.WithVerbose(true),
@@ -20,8 +24,15 @@ func HTTP(configHandler ConfigHandler, init func(router *bunrouter.Router)) {
 
 		bunrouter.Use(bunrouterotel.NewMiddleware(
 			bunrouterotel.WithClientIP(),
-		)))
+		)),
+		bunrouter.Use(middlewares...),
+		bunrouter.Use(httputils.NegotiateMiddleware))
+
+	setJSONOptions(configHandler.GetConfig())
+	configHandler.OnChange("json", setJSONOptions)
 
+	lifecycle.Health().registerRoutes(r)
+	lifecycle.Catalog().addRouter(r)
 	init(r)
 
 	handler := otelhttp.NewHandler(r, "")
@@ -33,11 +44,26 @@ func HTTP(configHandler ConfigHandler, init func(router *bunrouter.Router)) {
 		Handler:      handler,
 	}
 
-	go func() {
-		if err := httpSrv.ListenAndServe(); err != nil && err.Error() != "http: Server closed" {
-			log.Fatalf("ListenAndServe failed: %s", err)
+	lifecycle.OnStop(httpSrv.Shutdown)
+	lifecycle.Go("http server", func() error {
+		if err := httpSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
 		}
-	}()
+
+		return nil
+	})
 
 	fmt.Printf("listening on http://%s\n", httpSrv.Addr)
 }
+
+// setJSONOptions applies the `json` keys, which control how proto messages are
+// rendered.
+func setJSONOptions(config *Config) {
+	var opts httputils.JSONOptions
+	if err := config.Env.UnmarshalKey("json", &opts); err != nil {
+		slog.Warn("decode config key json error", "error", err)
+		return
+	}
+
+	httputils.SetJSONOptions(opts)
+}
@@ -0,0 +1,282 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Configuration is resolved from these sources, each one overriding the
+// previous: compiled defaults, imported etcd namespaces, the embedded file,
+// etcd, APP_* environment variables and --set flags.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEtcd    = "etcd"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+const envPrefix = "APP_"
+
+// reservedEnv are APP_* variables read by the framework itself and never
+// turned into configuration keys.
+var reservedEnv = map[string]bool{
+	secretKeyEnv:     true,
+	secretKeyFileEnv: true,
+	envEnv:           true,
+}
+
+var DefaultSettings = map[string]any{
+	"config_mode":             ConfigModeSeed,
+	"config_fallback":         false,
+	"log_level":               "info",
+	"shutdown_timeout":        "30s",
+	"shutdown_delay":          "0s",
+	"db.log.mode":             QueryLogOff,
+	"cors.origins":            []string{"http://localhost:4000"},
+	"cors.methods":            []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+	"cors.headers":            []string{"Accept", "Authorization", "Content-Type"},
+	"cors.credentials":        true,
+	"json.use_proto_names":    false,
+	"json.emit_unpopulated":   false,
+	"json.use_enum_numbers":   false,
+	"openapi.ui":              false,
+	"openapi.version":         "1.0.0",
+	"openapi.redoc_bundle":    "",
+	"openapi.redoc_integrity": "",
+}
+
+type ConfigLayer struct {
+	Source string
+	Values map[string]any
+}
+
+type ConfigSource struct {
+	Key       string
+	Source    string
+	Value     any
+	Effective bool
+}
+
+type ConfigOption func(h *ConfigHandler)
+
+func WithDefaults(defaults map[string]any) ConfigOption {
+	return func(h *ConfigHandler) {
+		for key, value := range defaults {
+			h.defaults[strings.ToLower(key)] = value
+		}
+	}
+}
+
+// withSettings decodes the configuration into the value returned by
+// newSettings every time it is resolved.
+func withSettings(newSettings func() any) ConfigOption {
+	return func(h *ConfigHandler) {
+		h.newSettings = newSettings
+	}
+}
+
+// WithOverrides applies key=value pairs on top of every other source.
+func WithOverrides(overrides []string) ConfigOption {
+	return func(h *ConfigHandler) {
+		h.overrides = append(h.overrides, overrides...)
+	}
+}
+
+// resolveLayers returns the configuration layers in precedence order. remote
+// may be nil when etcd has not been read yet.
+func (h *ConfigHandler) resolveLayers(remote []byte) ([]ConfigLayer, error) {
+	layers := []ConfigLayer{
+		{Source: SourceDefault, Values: flattenSettings("", h.defaults, map[string]any{})},
+	}
+
+	imports, err := h.importLayers()
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, imports...)
+
+	file, err := settingsLayer(SourceFile, h.file)
+	if err != nil {
+		return nil, fmt.Errorf("embedded configuration: %w", err)
+	}
+	layers = append(layers, file)
+
+	if remote != nil {
+		etcd, err := settingsLayer(SourceEtcd, remote)
+		if err != nil {
+			return nil, fmt.Errorf("etcd configuration: %w", err)
+		}
+		layers = append(layers, etcd)
+	}
+
+	known := make(map[string]bool)
+	for _, layer := range layers {
+		for key := range layer.Values {
+			known[key] = true
+		}
+	}
+
+	flags, err := overridesLayer(h.overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(layers, envLayer(known), flags), nil
+}
+
+func mergeLayers(layers []ConfigLayer) (*viper.Viper, error) {
+	v := viper.New()
+
+	for _, layer := range layers {
+		if err := v.MergeConfigMap(unflattenSettings(layer.Values)); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// explainKey lists the value of every leaf under key in each layer that sets
+// it, marking the layer that wins.
+func explainKey(layers []ConfigLayer, key string) []ConfigSource {
+	key = strings.ToLower(key)
+
+	var sources []ConfigSource
+	winners := make(map[string]int)
+
+	for _, layer := range layers {
+		names := make([]string, 0, len(layer.Values))
+		for name := range layer.Values {
+			if name == key || strings.HasPrefix(name, key+".") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			winners[name] = len(sources)
+			sources = append(sources, ConfigSource{
+				Key:    name,
+				Source: layer.Source,
+				Value:  layer.Values[name],
+			})
+		}
+	}
+
+	for _, i := range winners {
+		sources[i].Effective = true
+	}
+
+	return sources
+}
+
+func settingsLayer(source string, raw []byte) (ConfigLayer, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+
+	if err := v.ReadConfig(bytes.NewReader(raw)); err != nil {
+		return ConfigLayer{}, err
+	}
+
+	return ConfigLayer{
+		Source: source,
+		Values: flattenSettings("", v.AllSettings(), map[string]any{}),
+	}, nil
+}
+
+// envLayer reads APP_* variables. A double underscore separates nested keys
+// (APP_DB__MAX_OPEN_CONNS); otherwise the name is matched against known keys
+// with dots replaced by underscores (APP_DB_MAX_OPEN_CONNS).
+func envLayer(known map[string]bool) ConfigLayer {
+	values := make(map[string]any)
+
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(name, envPrefix) || reservedEnv[name] {
+			continue
+		}
+
+		values[envKey(strings.ToLower(strings.TrimPrefix(name, envPrefix)), known)] = value
+	}
+
+	return ConfigLayer{Source: SourceEnv, Values: values}
+}
+
+func envKey(name string, known map[string]bool) string {
+	if strings.Contains(name, "__") {
+		return strings.ReplaceAll(name, "__", ".")
+	}
+
+	for key := range known {
+		if strings.ReplaceAll(key, ".", "_") == name {
+			return key
+		}
+	}
+
+	return name
+}
+
+func overridesLayer(overrides []string) (ConfigLayer, error) {
+	values := make(map[string]any)
+
+	for _, override := range overrides {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok || key == "" {
+			return ConfigLayer{}, fmt.Errorf("invalid override %q, expected key=value", override)
+		}
+
+		values[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+
+	return ConfigLayer{Source: SourceFlag, Values: values}, nil
+}
+
+func flattenSettings(prefix string, settings map[string]any, out map[string]any) map[string]any {
+	for key, value := range settings {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if nested, ok := value.(map[string]any); ok {
+			flattenSettings(key, nested, out)
+			continue
+		}
+
+		out[key] = value
+	}
+
+	return out
+}
+
+func unflattenSettings(values map[string]any) map[string]any {
+	out := make(map[string]any)
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		node := out
+
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				node[part] = child
+			}
+			node = child
+		}
+
+		node[parts[len(parts)-1]] = values[key]
+	}
+
+	return out
+}
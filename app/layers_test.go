@@ -0,0 +1,98 @@
+package app
+
+import (
+	"testing"
+)
+
+func newTestConfigHandler(file string, opts ...ConfigOption) *ConfigHandler {
+	h := &ConfigHandler{
+		name:     "test",
+		file:     []byte(file),
+		defaults: map[string]any{"url": "localhost:1", "db.log.mode": QueryLogOff, "log_level": "info"},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+func TestLayerPrecedence(t *testing.T) {
+	t.Setenv("APP_DB_LOG_MODE", "slow")
+	t.Setenv("APP_CORS__MAX_AGE", "60s")
+
+	h := newTestConfigHandler("url: localhost:2\nlog_level: warn\ndb:\n  log:\n    mode: verbose\n", WithOverrides([]string{"LOG_LEVEL=debug"}))
+	h.imports = map[string][]byte{"shared": []byte("url: localhost:0\ntimeout: 5s\n")}
+	h.importNames = []string{"shared"}
+
+	config, err := h.resolve([]byte("url: localhost:3\n"))
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		value  string
+		source string
+	}{
+		{"timeout", "5s", SourceImport + ":shared"},
+		{"url", "localhost:3", SourceEtcd},
+		{"db.log.mode", "slow", SourceEnv},
+		{"cors.max_age", "60s", SourceEnv},
+		{"log_level", "debug", SourceFlag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := config.Env.GetString(tt.key); got != tt.value {
+				t.Fatalf("%s = %q, want %q", tt.key, got, tt.value)
+			}
+
+			var effective []string
+			for _, source := range explainKey(config.layers, tt.key) {
+				if source.Effective {
+					effective = append(effective, source.Source)
+				}
+			}
+			if len(effective) != 1 || effective[0] != tt.source {
+				t.Fatalf("%s effective from %v, want %s", tt.key, effective, tt.source)
+			}
+		})
+	}
+}
+
+func TestLayerPrecedenceWithoutEtcd(t *testing.T) {
+	config, err := newTestConfigHandler("url: localhost:2\n").resolve(nil)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	if got := config.Env.GetString("url"); got != "localhost:2" {
+		t.Fatalf("url = %q, want the embedded file value", got)
+	}
+}
+
+func TestOverridesLayer(t *testing.T) {
+	tests := []struct {
+		override string
+		key      string
+		err      bool
+	}{
+		{"db.dsn=postgres://x", "db.dsn", false},
+		{" Log_Level =warn", "log_level", false},
+		{"missing", "", true},
+		{"=value", "", true},
+	}
+
+	for _, tt := range tests {
+		layer, err := overridesLayer([]string{tt.override})
+		if (err != nil) != tt.err {
+			t.Fatalf("overridesLayer(%q) error = %v, want error %v", tt.override, err, tt.err)
+		}
+
+		if _, ok := layer.Values[tt.key]; !tt.err && !ok {
+			t.Fatalf("overridesLayer(%q) = %v, missing %s", tt.override, layer.Values, tt.key)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Lifecycle runs the servers of an application until it receives a signal or
+// one of them fails, then shuts down in phases: servers stop accepting and
+// drain in flight requests, shutdown hooks run, and resources such as the
+// database and etcd clients are closed. Hooks and closers run in reverse
+// order of registration, like deferred calls.
+type Lifecycle struct {
+	mu      sync.Mutex
+	servers []func(ctx context.Context) error
+	hooks   []func(ctx context.Context) error
+	closers []func() error
+	health  *Health
+	catalog *Catalog
+
+	delay    atomic.Int64
+	stopping atomic.Bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	shutdown sync.Once
+}
+
+func NewLifecycle() *Lifecycle {
+	l := &Lifecycle{
+		stop: make(chan struct{}),
+	}
+	l.health = newHealth(l)
+	l.catalog = &Catalog{}
+
+	return l
+}
+
+// Catalog lists what the servers run by the lifecycle serve.
+func (l *Lifecycle) Catalog() *Catalog {
+	return l.catalog
+}
+
+// Health holds the readiness checks, which fail once the shutdown starts.
+func (l *Lifecycle) Health() *Health {
+	return l.health
+}
+
+// OnStop registers how a server stops accepting connections and drains the
+// ones in flight, returning early once ctx is done.
+func (l *Lifecycle) OnStop(fn func(ctx context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.servers = append(l.servers, fn)
+}
+
+// OnShutdown registers a hook run once every server has stopped and before
+// resources are closed.
+func (l *Lifecycle) OnShutdown(fn func(ctx context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.hooks = append(l.hooks, fn)
+}
+
+// OnClose registers a resource closed last.
+func (l *Lifecycle) OnClose(fn func() error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closers = append(l.closers, fn)
+}
+
+// Go runs a server, stopping the application if it fails.
+func (l *Lifecycle) Go(name string, serve func() error) {
+	go func() {
+		if err := serve(); err != nil {
+			slog.Error("lifecycle hook failed", "hook", name, "error", err)
+			l.Stop()
+		}
+	}()
+}
+
+// SetShutdownDelay sets how long Shutdown waits between failing readiness
+// and stopping the servers, so load balancers stop routing requests to the
+// instance before it stops accepting them.
+func (l *Lifecycle) SetShutdownDelay(delay time.Duration) {
+	l.delay.Store(int64(delay))
+}
+
+// Stop asks Wait to return.
+func (l *Lifecycle) Stop() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+}
+
+// Stopping reports whether the shutdown has started.
+func (l *Lifecycle) Stopping() bool {
+	return l.stopping.Load()
+}
+
+// Wait blocks until SIGINT, SIGQUIT or SIGTERM is received, returning it, or
+// until Stop is called, returning nil.
+func (l *Lifecycle) Wait() os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+	defer signal.Stop(ch)
+
+	select {
+	case sig := <-ch:
+		fmt.Printf("received %s, shutting down\n", sig)
+		return sig
+	case <-l.stop:
+		return nil
+	}
+}
+
+// Shutdown fails readiness, waits for the shutdown delay, stops the servers,
+// runs the hooks and closes the resources, once. Servers and hooks share the
+// timeout; resources are closed regardless.
+func (l *Lifecycle) Shutdown(timeout time.Duration) error {
+	var err error
+
+	l.shutdown.Do(func() {
+		l.stopping.Store(true)
+		l.health.shutdown()
+		l.Stop()
+
+		time.Sleep(time.Duration(l.delay.Load()))
+
+		l.mu.Lock()
+		servers := append([]func(ctx context.Context) error(nil), l.servers...)
+		hooks := append([]func(ctx context.Context) error(nil), l.hooks...)
+		closers := append([]func() error(nil), l.closers...)
+		l.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(servers))
+		for i, stop := range servers {
+			wg.Add(1)
+			go func(i int, stop func(ctx context.Context) error) {
+				defer wg.Done()
+				errs[i] = stop(ctx)
+			}(i, stop)
+		}
+		wg.Wait()
+
+		for i := len(hooks) - 1; i >= 0; i-- {
+			errs = append(errs, hooks[i](ctx))
+		}
+
+		for i := len(closers) - 1; i >= 0; i-- {
+			errs = append(errs, closers[i]())
+		}
+
+		err = errors.Join(errs...)
+	})
+
+	return err
+}
@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the lifecycle steps in the order they run.
+type recorder struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (r *recorder) add(step string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.steps = append(r.steps, step)
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.steps...)
+}
+
+func TestLifecycleShutdownOrder(t *testing.T) {
+	l := NewLifecycle()
+	r := &recorder{}
+
+	for _, name := range []string{"http", "grpc"} {
+		l.OnStop(func(ctx context.Context) error {
+			if !l.Stopping() {
+				t.Errorf("%s stopped before the lifecycle reported stopping", name)
+			}
+			r.add("stop")
+			return nil
+		})
+	}
+	l.OnShutdown(func(ctx context.Context) error { r.add("hook 1"); return nil })
+	l.OnShutdown(func(ctx context.Context) error { r.add("hook 2"); return nil })
+	l.OnClose(func() error { r.add("close 1"); return nil })
+	l.OnClose(func() error { r.add("close 2"); return nil })
+
+	if err := l.Shutdown(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"stop", "stop", "hook 2", "hook 1", "close 2", "close 1"}
+	if got := r.list(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("steps = %v, want %v", got, want)
+	}
+
+	if ready, _ := l.Health().Ready(context.Background()); ready {
+		t.Fatalf("expected the lifecycle not to be ready after shutdown")
+	}
+	if l.Wait() != nil {
+		t.Fatalf("expected Wait to return once stopped")
+	}
+}
+
+func TestLifecycleShutdownOnce(t *testing.T) {
+	l := NewLifecycle()
+	r := &recorder{}
+	failure := errors.New("close failed")
+
+	l.OnStop(func(ctx context.Context) error { r.add("stop"); return nil })
+	l.OnShutdown(func(ctx context.Context) error { r.add("hook"); return nil })
+	l.OnClose(func() error { r.add("close"); return failure })
+
+	if err := l.Shutdown(time.Second); !errors.Is(err, failure) {
+		t.Fatalf("Shutdown = %v, want the close error", err)
+	}
+	if err := l.Shutdown(time.Second); err != nil {
+		t.Fatalf("second Shutdown = %v, want nil", err)
+	}
+
+	if got := r.list(); !reflect.DeepEqual(got, []string{"stop", "hook", "close"}) {
+		t.Fatalf("steps = %v, want every step once", got)
+	}
+}
+
+func TestLifecycleClosesAfterTimeout(t *testing.T) {
+	l := NewLifecycle()
+	r := &recorder{}
+
+	l.OnStop(func(ctx context.Context) error {
+		<-ctx.Done()
+		r.add("stop")
+		return ctx.Err()
+	})
+	l.OnShutdown(func(ctx context.Context) error {
+		<-ctx.Done()
+		r.add("hook")
+		return ctx.Err()
+	})
+	l.OnClose(func() error { r.add("close"); return nil })
+
+	start := time.Now()
+	err := l.Shutdown(50 * time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want the deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Shutdown took %s, want the servers and hooks to share the timeout", elapsed)
+	}
+
+	if got := r.list(); !reflect.DeepEqual(got, []string{"stop", "hook", "close"}) {
+		t.Fatalf("steps = %v, want the resources closed after the timeout", got)
+	}
+}
+
+func TestLifecycleShutdownDelay(t *testing.T) {
+	l := NewLifecycle()
+	r := &recorder{}
+	delay := 100 * time.Millisecond
+
+	l.SetShutdownDelay(delay)
+	l.OnStop(func(ctx context.Context) error { r.add("stop"); return nil })
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- l.Shutdown(time.Second) }()
+
+	for !l.Stopping() {
+		time.Sleep(time.Millisecond)
+	}
+	if ready, _ := l.Health().Ready(context.Background()); ready {
+		t.Fatalf("expected readiness to fail during the shutdown delay")
+	}
+	if steps := r.list(); len(steps) != 0 {
+		t.Fatalf("steps = %v, want the servers still running during the shutdown delay", steps)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Fatalf("Shutdown took %s, want at least the %s delay", elapsed, delay)
+	}
+	if steps := r.list(); !reflect.DeepEqual(steps, []string{"stop"}) {
+		t.Fatalf("steps = %v, want the servers stopped after the delay", steps)
+	}
+}
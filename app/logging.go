@@ -0,0 +1,27 @@
+package app
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// watchLogLevel applies the log_level key to the default slog logger and keeps
+// it in sync with etcd.
+func (h *ConfigHandler) watchLogLevel() {
+	setLogLevel(h.GetConfig().Env.GetString("log_level"))
+	OnValueChange(h, "log_level", setLogLevel)
+}
+
+func setLogLevel(value string) {
+	if value == "" {
+		value = "info"
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(value))); err != nil {
+		slog.Warn("invalid log level", "value", value, "error", err)
+		return
+	}
+
+	slog.SetLogLoggerLevel(level)
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestSetLogLevel(t *testing.T) {
+	defer setLogLevel("info")
+
+	tests := []struct {
+		value string
+		level slog.Level
+		debug bool
+	}{
+		{"debug", slog.LevelDebug, true},
+		{"warn", slog.LevelWarn, false},
+		{"", slog.LevelInfo, false},
+		{"verbose", slog.LevelInfo, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			setLogLevel("info")
+			setLogLevel(tt.value)
+
+			if !slog.Default().Enabled(context.Background(), tt.level) {
+				t.Fatalf("expected %s to be enabled", tt.level)
+			}
+			if got := slog.Default().Enabled(context.Background(), slog.LevelDebug); got != tt.debug {
+				t.Fatalf("debug enabled = %v, want %v", got, tt.debug)
+			}
+		})
+	}
+}
@@ -1,40 +1,377 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/alpha-omega-corp/core/app/proto"
+	"github.com/alpha-omega-corp/core/httputils"
 	"github.com/rs/cors"
 	"github.com/uptrace/bunrouter"
+	"golang.org/x/time/rate"
+	"log"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type AuthMiddleware struct {
-	authClient AuthClient
+	service proto.AuthServiceClient
 }
 
-func NewAuthMiddleware(client AuthClient) *AuthMiddleware {
+func NewAuthMiddleware(service proto.AuthServiceClient) *AuthMiddleware {
 	return &AuthMiddleware{
-		authClient: client,
+		service: service,
 	}
 }
 
 func (m *AuthMiddleware) Auth(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
 	return func(w http.ResponseWriter, req bunrouter.Request) error {
-		err := m.authClient.Validate(w, req)
-		if err != nil {
-			return err
+		user, err := authenticate(req.Context(), m.service, req)
+		if err != nil || user == nil {
+			httputils.Error(w, errors.New("unauthorized"), http.StatusUnauthorized)
+			return nil
 		}
 
-		return next(w, req)
+		return next(w, req.WithContext(context.WithValue(req.Context(), userContextKey{}, user)))
 	}
 }
 
-func NewCorsMiddleware() bunrouter.MiddlewareFunc {
-	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:4000"},
-		AllowedMethods:   []string{"GET", "PUT", "POST", "DELETE"},
-		AllowCredentials: true,
+// CorsConfig is the `cors` key. Origins are matched exactly, or anywhere a
+// `*` stands, and "*" allows every origin, which requires Credentials to be
+// off; OriginPatterns are regular expressions matched against the whole
+// lowercased origin.
+type CorsConfig struct {
+	Origins        []string      `mapstructure:"origins"`
+	OriginPatterns []string      `mapstructure:"origin_patterns" validate:"omitempty,dive,regexp"`
+	Methods        []string      `mapstructure:"methods"`
+	Headers        []string      `mapstructure:"headers"`
+	ExposedHeaders []string      `mapstructure:"exposed_headers"`
+	MaxAge         time.Duration `mapstructure:"max_age"`
+	Credentials    bool          `mapstructure:"credentials"`
+}
+
+// NewCorsMiddleware applies the `cors` configuration, following its changes in
+// etcd. It must run for every route, so that preflight requests are answered
+// before they reach the method not allowed handler.
+func NewCorsMiddleware(configHandler *ConfigHandler) bunrouter.MiddlewareFunc {
+	var corsHandler atomic.Pointer[cors.Cors]
+
+	c, err := newCors(configHandler.GetConfig().Cors)
+	if err != nil {
+		log.Fatalf("cors config error: %v", err)
+	}
+	corsHandler.Store(c)
+
+	configHandler.OnChange("cors", func(config *Config) {
+		c, err := newCors(config.Cors)
+		if err != nil {
+			slog.Warn("ignoring invalid cors config", "error", err)
+			return
+		}
+
+		corsHandler.Store(c)
 	})
 
 	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
-		return bunrouter.HTTPHandler(corsHandler.Handler(next))
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			return bunrouter.HTTPHandler(corsHandler.Load().Handler(next))(w, req)
+		}
+	}
+}
+
+func newCors(config CorsConfig) (*cors.Cors, error) {
+	maxAge := int(config.MaxAge / time.Second)
+	if config.MaxAge < 0 {
+		maxAge = -1
+	}
+
+	options := cors.Options{
+		AllowedMethods:   config.Methods,
+		AllowedHeaders:   config.Headers,
+		ExposedHeaders:   config.ExposedHeaders,
+		MaxAge:           maxAge,
+		AllowCredentials: config.Credentials,
 	}
+
+	if slices.Contains(config.Origins, "*") {
+		// Credentialed requests from any site would be allowed.
+		if config.Credentials {
+			return nil, errors.New(`cors origin "*" cannot be used with credentials, list the origins or turn cors.credentials off`)
+		}
+		options.AllowedOrigins = []string{"*"}
+
+		return cors.New(options), nil
+	}
+
+	allowOrigin, err := originMatcher(config.Origins, config.OriginPatterns)
+	if err != nil {
+		return nil, err
+	}
+	options.AllowOriginFunc = allowOrigin
+
+	return cors.New(options), nil
+}
+
+func originMatcher(origins []string, patterns []string) (func(origin string) bool, error) {
+	exact := make(map[string]bool)
+	var matchers []*regexp.Regexp
+
+	for _, origin := range origins {
+		origin = strings.ToLower(origin)
+
+		switch {
+		case strings.Contains(origin, "*"):
+			parts := strings.Split(origin, "*")
+			for i, part := range parts {
+				parts[i] = regexp.QuoteMeta(part)
+			}
+			matchers = append(matchers, regexp.MustCompile("^"+strings.Join(parts, ".*")+"$"))
+		default:
+			exact[origin] = true
+		}
+	}
+
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("origin pattern %q: %w", pattern, err)
+		}
+		matchers = append(matchers, re)
+	}
+
+	return func(origin string) bool {
+		origin = strings.ToLower(origin)
+		if exact[origin] {
+			return true
+		}
+
+		for _, re := range matchers {
+			if re.MatchString(origin) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// NewRateLimitMiddleware limits each client, identified by its IP address,
+// to rate_limit.rps requests per second.
+func NewRateLimitMiddleware(configHandler *ConfigHandler) bunrouter.MiddlewareFunc {
+	limiter := newRateLimiter()
+
+	apply := func(config *Config) {
+		rps := config.Env.GetFloat64("rate_limit.rps")
+		if rps <= 0 {
+			limiter.configure(rate.Inf, 0)
+			return
+		}
+
+		burst := config.Env.GetInt("rate_limit.burst")
+		if burst <= 0 {
+			burst = int(math.Ceil(rps))
+		}
+
+		limiter.configure(rate.Limit(rps), burst)
+	}
+
+	apply(configHandler.GetConfig())
+	configHandler.OnChange("rate_limit", apply)
+
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			if !limiter.allow(clientIP(req.Request), time.Now()) {
+				w.Header().Set("Retry-After", "1")
+				httputils.Error(w, errors.New("rate limit exceeded"), http.StatusTooManyRequests)
+				return nil
+			}
+
+			return next(w, req)
+		}
+	}
+}
+
+// rateLimiter keeps one token bucket per client. Buckets left idle for
+// rateLimitIdle are dropped.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	clients map[string]*clientLimiter
+	swept   time.Time
+}
+
+type clientLimiter struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+const rateLimitIdle = 5 * time.Minute
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		limit:   rate.Inf,
+		clients: make(map[string]*clientLimiter),
+	}
+}
+
+func (l *rateLimiter) configure(limit rate.Limit, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit, l.burst = limit, burst
+	for _, client := range l.clients {
+		client.limiter.SetLimit(limit)
+		client.limiter.SetBurst(burst)
+	}
+}
+
+func (l *rateLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == rate.Inf {
+		return true
+	}
+
+	if now.Sub(l.swept) > rateLimitIdle {
+		for k, client := range l.clients {
+			if now.Sub(client.seen) > rateLimitIdle {
+				delete(l.clients, k)
+			}
+		}
+		l.swept = now
+	}
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = client
+	}
+	client.seen = now
+
+	return client.limiter.AllowN(now, 1)
+}
+
+// clientIP returns the address the request came from, without the port.
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+type userContextKey struct{}
+
+// UserFromContext returns the user authenticated by NewPermissionMiddleware
+// or NewFlagsMiddleware.
+func UserFromContext(ctx context.Context) (*proto.User, bool) {
+	switch user := ctx.Value(userContextKey{}).(type) {
+	case *proto.User:
+		return user, true
+	case func() *proto.User:
+		resolved := user()
+		return resolved, resolved != nil
+	}
+
+	return nil, false
+}
+
+// authenticate validates the bearer token of req, returning nil without a
+// token.
+func authenticate(ctx context.Context, service proto.AuthServiceClient, req bunrouter.Request) (*proto.User, error) {
+	token, ok := bearerToken(req.Header.Get("Authorization"))
+	if !ok {
+		return nil, nil
+	}
+
+	res, err := service.Validate(ctx, &proto.ValidateRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.User, nil
+}
+
+func bearerToken(header string) (string, bool) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	return token, ok && token != ""
+}
+
+// NewPermissionMiddleware only lets through users holding permission, a
+// <service>.<read|write|manage> key of their permission matrix. Service names
+// are matched case-insensitively, like the matrix keys.
+func NewPermissionMiddleware(service proto.AuthServiceClient, permission string) bunrouter.MiddlewareFunc {
+	permission = strings.ToLower(permission)
+
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			user, err := authenticate(req.Context(), service, req)
+			if err != nil || user == nil {
+				httputils.Error(w, errors.New("unauthorized"), http.StatusUnauthorized)
+				return nil
+			}
+
+			permissions, err := service.GetUserPermissions(req.Context(), &proto.GetUserPermissionsRequest{UserId: user.Id})
+			if err != nil {
+				return err
+			}
+
+			if !permissions.Matrix[permission] {
+				httputils.Error(w, fmt.Errorf("%s permission required", permission), http.StatusForbidden)
+				return nil
+			}
+
+			return next(w, req.WithContext(context.WithValue(req.Context(), userContextKey{}, user)))
+		}
+	}
+}
+
+// NewFlagsMiddleware makes the feature flags available to handlers through
+// FlagEnabled, evaluated for the authenticated user if any. The bearer token
+// is only validated once a flag is evaluated or the user is looked up.
+func NewFlagsMiddleware(store *FlagStore, service proto.AuthServiceClient) bunrouter.MiddlewareFunc {
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			ctx := req.Context()
+
+			user := sync.OnceValue(func() *proto.User {
+				user, err := authenticate(ctx, service, req)
+				if err != nil {
+					return nil
+				}
+				return user
+			})
+
+			subject := func() FlagSubject {
+				return userSubject(user())
+			}
+
+			ctx = context.WithValue(ctx, userContextKey{}, user)
+			return next(w, req.WithContext(contextWithFlags(ctx, store, subject)))
+		}
+	}
+}
+
+func userSubject(user *proto.User) FlagSubject {
+	if user == nil {
+		return FlagSubject{}
+	}
+
+	subject := FlagSubject{UserID: user.Id, Email: user.Email}
+	for _, role := range user.Roles {
+		subject.Roles = append(subject.Roles, role.Name)
+	}
+
+	return subject
 }
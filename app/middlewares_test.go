@@ -0,0 +1,128 @@
+package app
+
+import (
+	"golang.org/x/time/rate"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterPerClient(t *testing.T) {
+	limiter := newRateLimiter()
+	limiter.configure(rate.Limit(1), 1)
+	now := time.Now()
+
+	if !limiter.allow("10.0.0.1", now) {
+		t.Fatalf("expected the first request of a client to pass")
+	}
+	if limiter.allow("10.0.0.1", now) {
+		t.Fatalf("expected the second request of a client to be limited")
+	}
+	if !limiter.allow("10.0.0.2", now) {
+		t.Fatalf("a client must not be limited by another one")
+	}
+
+	limiter.allow("10.0.0.3", now.Add(2*rateLimitIdle))
+	if _, ok := limiter.clients["10.0.0.1"]; ok {
+		t.Fatalf("expected idle clients to be dropped")
+	}
+
+	limiter.configure(rate.Inf, 0)
+	if !limiter.allow("10.0.0.3", now.Add(2*rateLimitIdle)) {
+		t.Fatalf("expected no limit once rate_limit.rps is unset")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   string
+	}{
+		{"10.0.0.1:5123", "10.0.0.1"},
+		{"[::1]:5123", "::1"},
+		{"10.0.0.1", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		if got := clientIP(&http.Request{RemoteAddr: tt.remote}); got != tt.want {
+			t.Errorf("clientIP(%q) = %q, want %q", tt.remote, got, tt.want)
+		}
+	}
+}
+
+func TestOriginMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		origins  []string
+		patterns []string
+		origin   string
+		want     bool
+	}{
+		{"exact", []string{"https://app.example.com"}, nil, "https://app.example.com", true},
+		{"exact other", []string{"https://app.example.com"}, nil, "https://evil.com", false},
+		{"exact case", []string{"https://App.example.com"}, nil, "https://APP.example.com", true},
+		{"wildcard", []string{"https://*.example.com"}, nil, "https://api.example.com", true},
+		{"wildcard case", []string{"https://*.example.com"}, nil, "https://API.Example.com", true},
+		{"wildcard suffix", []string{"https://*.example.com"}, nil, "https://example.com.evil.com", false},
+		{"wildcard dot", []string{"https://*.example.com"}, nil, "https://apiXexample.com", false},
+		{"pattern", nil, []string{`https://(app|api)\.example\.com`}, "https://api.example.com", true},
+		{"pattern case", nil, []string{`https://(app|api)\.example\.com`}, "HTTPS://API.EXAMPLE.COM", true},
+		{"pattern anchored", nil, []string{`https://api\.example\.com`}, "https://api.example.com.evil.com", false},
+		{"nothing", nil, nil, "https://app.example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := originMatcher(tt.origins, tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := match(tt.origin); got != tt.want {
+				t.Fatalf("match(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := originMatcher(nil, []string{"("}); err == nil {
+		t.Fatalf("expected an error for an invalid pattern")
+	}
+}
+
+func TestCorsAnyOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      CorsConfig
+		err         bool
+		allowOrigin string
+		credentials string
+	}{
+		{"with credentials", CorsConfig{Origins: []string{"*"}, Credentials: true}, true, "", ""},
+		{"without credentials", CorsConfig{Origins: []string{"*"}}, false, "*", ""},
+		{"listed with credentials", CorsConfig{Origins: []string{"https://app.example.com"}, Credentials: true}, false, "https://app.example.com", "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newCors(tt.config)
+			if (err != nil) != tt.err {
+				t.Fatalf("newCors error = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Origin", "https://app.example.com")
+			w := httptest.NewRecorder()
+			c.Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(w, req)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+				t.Fatalf("Access-Control-Allow-Credentials = %q, want %q", got, tt.credentials)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package app
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun/migrate"
+	"github.com/urfave/cli/v3"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+const migrationsDir = "migrations"
+
+// authMigrations create the tables of the models CreateApi registers.
+//
+//go:embed migrations/*.sql
+var authMigrations embed.FS
+
+// Migrations returns the registry Go migrations are added to; SQL files under
+// the embedded migrations directory are discovered automatically.
+func (app *App) Migrations() *migrate.Migrations {
+	return app.migrations
+}
+
+func (app *App) dbCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "db",
+		Usage: "database management",
+		Commands: []*cli.Command{
+			app.migrateCommand(),
+			app.seedCommand(),
+		},
+	}
+}
+
+func (app *App) migrateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "versioned database migrations",
+		Commands: []*cli.Command{
+			app.createCommand("migrate", "up", func(ctx context.Context, cmd *cli.Command) {
+				migrator := app.newMigrator(ctx)
+
+				if err := migrator.Lock(ctx); err != nil {
+					panic(err)
+				}
+				defer app.unlockMigrator(ctx, migrator)
+
+				group, err := migrator.Migrate(ctx)
+				if err != nil {
+					panic(err)
+				}
+
+				if group.IsZero() {
+					fmt.Println("there are no new migrations to run (database is up to date)")
+					return
+				}
+
+				fmt.Printf("migrated to %s\n", group)
+			}),
+			app.createCommand("migrate", "down", func(ctx context.Context, cmd *cli.Command) {
+				migrator := app.newMigrator(ctx)
+
+				if err := migrator.Lock(ctx); err != nil {
+					panic(err)
+				}
+				defer app.unlockMigrator(ctx, migrator)
+
+				group, err := migrator.Rollback(ctx)
+				if err != nil {
+					panic(err)
+				}
+
+				if group.IsZero() {
+					fmt.Println("there are no groups to roll back")
+					return
+				}
+
+				fmt.Printf("rolled back %s\n", group)
+			}),
+			app.createCommand("migrate", "status", func(ctx context.Context, cmd *cli.Command) {
+				migrator := app.newMigrator(ctx)
+
+				ms, err := migrator.MigrationsWithStatus(ctx)
+				if err != nil {
+					panic(err)
+				}
+
+				fmt.Printf("migrations: %s\n", ms)
+				fmt.Printf("unapplied migrations: %s\n", ms.Unapplied())
+				fmt.Printf("last migration group: %s\n", ms.LastGroup())
+			}),
+			app.createCommand("migrate", "lock", func(ctx context.Context, cmd *cli.Command) {
+				if err := app.newMigrator(ctx).Lock(ctx); err != nil {
+					panic(err)
+				}
+
+				fmt.Println("migrations locked")
+			}),
+			app.createCommand("migrate", "unlock", func(ctx context.Context, cmd *cli.Command) {
+				if err := app.newMigrator(ctx).Unlock(ctx); err != nil {
+					panic(err)
+				}
+
+				fmt.Println("migrations unlocked")
+			}),
+			app.newCreateMigrationCommand(),
+		},
+	}
+}
+
+func (app *App) newCreateMigrationCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "create",
+		Category:  "migrate",
+		Usage:     "create up and down migration files",
+		ArgsUsage: "<name>",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "go",
+				Usage: "create a Go migration instead of SQL files",
+			},
+			&cli.BoolFlag{
+				Name:  "tx",
+				Usage: "run the SQL migration inside a transaction",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			name := strings.Join(cmd.Args().Slice(), "_")
+			if name == "" {
+				return errors.New("migration name is required")
+			}
+
+			if err := os.MkdirAll(migrationsDir, 0o755); err != nil {
+				return err
+			}
+
+			// Creating files does not touch the database.
+			migrator := migrate.NewMigrator(nil, app.migrations)
+
+			var files []*migrate.MigrationFile
+			switch {
+			case cmd.Bool("go"):
+				file, err := migrator.CreateGoMigration(ctx, name)
+				if err != nil {
+					return err
+				}
+				files = append(files, file)
+			case cmd.Bool("tx"):
+				created, err := migrator.CreateTxSQLMigrations(ctx, name)
+				if err != nil {
+					return err
+				}
+				files = created
+			default:
+				created, err := migrator.CreateSQLMigrations(ctx, name)
+				if err != nil {
+					return err
+				}
+				files = created
+			}
+
+			for _, file := range files {
+				fmt.Printf("created migration %s (%s)\n", file.Name, file.Path)
+			}
+
+			return nil
+		},
+	}
+}
+
+func (app *App) newMigrator(ctx context.Context) *migrate.Migrator {
+	if app.dbHandler == nil {
+		panic("no database configured for application: " + app.name)
+	}
+
+	if err := app.discoverMigrations(); err != nil {
+		panic(err)
+	}
+
+	migrator := migrate.NewMigrator(app.dbHandler.Primary(), app.migrations)
+	if err := migrator.Init(ctx); err != nil {
+		panic(err)
+	}
+
+	return migrator
+}
+
+func (app *App) discoverMigrations() error {
+	if app.authTables {
+		sub, err := fs.Sub(authMigrations, migrationsDir)
+		if err != nil {
+			return err
+		}
+
+		if err := app.migrations.Discover(sub); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fs.Stat(app.fs, migrationsDir); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	sub, err := fs.Sub(app.fs, migrationsDir)
+	if err != nil {
+		return err
+	}
+
+	return app.migrations.Discover(sub)
+}
+
+func (app *App) unlockMigrator(ctx context.Context, migrator *migrate.Migrator) {
+	if err := migrator.Unlock(ctx); err != nil {
+		fmt.Printf("unlock migrations error: %v\n", err)
+	}
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"github.com/alpha-omega-corp/core/app/models"
+	"github.com/uptrace/bun/migrate"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuthMigrationsDiscovered(t *testing.T) {
+	app := &App{migrations: migrate.NewMigrations(), authTables: true}
+	if err := app.discoverMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	ms := app.migrations.Sorted()
+	if len(ms) == 0 {
+		t.Fatal("expected the auth tables migration")
+	}
+
+	for _, m := range ms {
+		if m.Up == nil || m.Down == nil {
+			t.Fatalf("migration %s needs up and down", m.Name)
+		}
+	}
+}
+
+func TestAuthMigrationsCreateModelTables(t *testing.T) {
+	raw, err := fs.ReadFile(authMigrations, "migrations/20240101000000_auth_tables.tx.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := string(raw)
+
+	db := newTestDB("postgres://primary/app")
+	db.RegisterModel((*models.UserToRole)(nil))
+	for _, model := range []any{models.User{}, models.Role{}, models.Service{}, models.Permission{}, models.UserToRole{}} {
+		table := db.Table(reflect.TypeOf(model))
+
+		start := strings.Index(up, "CREATE TABLE IF NOT EXISTS "+table.Name+" (")
+		if start < 0 {
+			t.Errorf("no table %s", table.Name)
+			continue
+		}
+		create := up[start : start+strings.Index(up[start:], ");")]
+
+		for _, field := range table.Fields {
+			if !strings.Contains(create, "\n    "+field.Name+" ") {
+				t.Errorf("table %s has no column %s", table.Name, field.Name)
+			}
+		}
+	}
+}
+
+// The seeder upserts on the conflict fields of each model, which needs a
+// matching unique constraint in the database.
+func TestAuthMigrationsBackSeedConflicts(t *testing.T) {
+	files, err := fs.Glob(authMigrations, "migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var up strings.Builder
+	for _, file := range files {
+		raw, err := fs.ReadFile(authMigrations, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up.Write(raw)
+	}
+
+	db := newTestDB("postgres://primary/app")
+	db.RegisterModel((*models.UserToRole)(nil))
+	for _, model := range []any{models.User{}, models.Role{}, models.Service{}, models.Permission{}} {
+		table := db.Table(reflect.TypeOf(model))
+		conflict := conflictFields(table)
+
+		if len(conflict) == 1 {
+			if !hasUniqueColumn(up.String(), conflict[0].Name) {
+				t.Errorf("table %s: column %s is not unique", table.Name, conflict[0].Name)
+			}
+			continue
+		}
+
+		columns := make([]string, len(conflict))
+		for i, field := range conflict {
+			columns[i] = field.Name
+		}
+
+		index := "ON " + table.Name + " (" + strings.Join(columns, ", ") + ")"
+		if !strings.Contains(up.String(), index) {
+			t.Errorf("table %s: no unique index %s", table.Name, index)
+		}
+	}
+}
+
+func hasUniqueColumn(sql string, column string) bool {
+	for _, line := range strings.Split(sql, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), column+" ") && strings.Contains(line, "UNIQUE") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Migrations must not drop existing rows to satisfy a new constraint.
+func TestAuthMigrationsKeepRows(t *testing.T) {
+	files, err := fs.Glob(authMigrations, "migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		raw, err := fs.ReadFile(authMigrations, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(strings.ToUpper(string(raw)), "DELETE FROM") {
+			t.Errorf("%s deletes rows", file)
+		}
+	}
+}
+
+func TestAuthFixtureFiles(t *testing.T) {
+	tests := []struct {
+		env        string
+		authTables bool
+		want       []string
+	}{
+		{"development", true, []string{"fixtures/fixture.yml"}},
+		{"production", true, nil},
+		{"development", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			app := &App{authTables: tt.authTables}
+
+			files, err := app.fixtureFiles(tt.env)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, file := range files {
+				if _, err := fs.Stat(file.fsys, file.name); err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, file.name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Fatalf("fixtureFiles = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
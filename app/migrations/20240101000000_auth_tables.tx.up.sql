@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS users (
+    id                 BIGSERIAL PRIMARY KEY,
+    name               VARCHAR,
+    email              VARCHAR UNIQUE,
+    encrypted_password VARCHAR,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS roles (
+    id   BIGSERIAL PRIMARY KEY,
+    name VARCHAR UNIQUE
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS services (
+    id   BIGSERIAL PRIMARY KEY,
+    name VARCHAR UNIQUE
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id         BIGSERIAL PRIMARY KEY,
+    read       BOOLEAN,
+    write      BOOLEAN,
+    manage     BOOLEAN,
+    role_id    BIGINT REFERENCES roles (id) ON DELETE CASCADE,
+    service_id BIGINT REFERENCES services (id) ON DELETE CASCADE
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS user_to_roles (
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
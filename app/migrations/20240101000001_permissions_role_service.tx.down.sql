@@ -0,0 +1 @@
+DROP INDEX IF EXISTS permissions_role_service_key;
@@ -0,0 +1,12 @@
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM permissions GROUP BY role_id, service_id HAVING count(*) > 1) THEN
+        RAISE EXCEPTION 'permissions holds several rows for the same role and service, merge them before migrating'
+            USING HINT = 'SELECT role_id, service_id, count(*) FROM permissions GROUP BY role_id, service_id HAVING count(*) > 1';
+    END IF;
+END
+$$;
+
+--bun:split
+
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_role_service_key ON permissions (role_id, service_id);
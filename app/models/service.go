@@ -5,8 +5,8 @@ type Permission struct {
 	Read      bool  `json:"read" bun:"read"`
 	Write     bool  `json:"write" bun:"write"`
 	Manage    bool  `json:"manage" bun:"manage"`
-	RoleId    int64
-	ServiceID int64
+	RoleId    int64 `bun:",unique:role_service"`
+	ServiceID int64 `bun:",unique:role_service"`
 }
 
 type Service struct {
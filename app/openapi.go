@@ -0,0 +1,466 @@
+package app
+
+import (
+	"fmt"
+	"github.com/alpha-omega-corp/core/httputils"
+	"github.com/uptrace/bunrouter"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	openAPIVersion   = "3.1.0"
+	bearerAuthScheme = "bearerAuth"
+	schemaRefPrefix  = "#/components/schemas/"
+)
+
+// OpenAPI describes the routes of a router as an OpenAPI 3.1 document. Routes
+// served by the gateway of an added service get their parameters and bodies
+// from the proto messages; other routes are listed without schemas.
+type OpenAPI struct {
+	title   string
+	version string
+
+	mu       sync.Mutex
+	services []openAPIService
+	secured  []securedRoutes
+}
+
+type openAPIService struct {
+	name   string
+	config *gatewayConfig
+}
+
+type securedRoutes struct {
+	prefix     string
+	permission string
+}
+
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+
+	json httputils.JSONOptions
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]JSONSchema            `json:"schemas"`
+	Responses       map[string]*OpenAPIResponse      `json:"responses"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes"`
+}
+
+type OpenAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+}
+
+type OpenAPIParameter struct {
+	Name     string     `json:"name"`
+	In       string     `json:"in"`
+	Required bool       `json:"required,omitempty"`
+	Schema   JSONSchema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Ref         string                      `json:"$ref,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema JSONSchema `json:"schema"`
+}
+
+type JSONSchema map[string]any
+
+func NewOpenAPI(title string, version string) *OpenAPI {
+	return &OpenAPI{title: title, version: version}
+}
+
+// AddService documents the gateway routes of service, registered with
+// RegisterGateway and the same options, which tell the methods requiring a
+// bearer token or a permission.
+func (o *OpenAPI) AddService(service string, opts ...GatewayOption) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.services = append(o.services, openAPIService{name: service, config: newGatewayConfig(opts...)})
+}
+
+// Secure marks the routes under prefix as requiring a bearer token whose user
+// holds permission.
+func (o *OpenAPI) Secure(prefix string, permission string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.secured = append(o.secured, securedRoutes{prefix: prefix, permission: permission})
+}
+
+func (o *OpenAPI) Document(r *Router) (*OpenAPIDocument, error) {
+	o.mu.Lock()
+	services := append([]openAPIService(nil), o.services...)
+	secured := append([]securedRoutes(nil), o.secured...)
+	o.mu.Unlock()
+
+	bindings := make(map[string]gatewayBinding)
+	authenticated := make(map[string]bool)
+	permissions := make(map[string]string)
+	for _, service := range services {
+		serviceBindings, err := gatewayBindings(service.name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, binding := range serviceBindings {
+			bindings[binding.verb+" "+binding.path] = binding
+			authenticated[binding.verb+" "+binding.path] = service.config.secured(binding.method)
+			if permission, ok := service.config.permissions[binding.method.FullName()]; ok {
+				permissions[binding.verb+" "+binding.path] = permission.name
+			}
+		}
+	}
+
+	doc := &OpenAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info:    OpenAPIInfo{Title: o.title, Version: o.version},
+		json:    httputils.GetJSONOptions(),
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+		Components: OpenAPIComponents{
+			Schemas: make(map[string]JSONSchema),
+			Responses: map[string]*OpenAPIResponse{
+				"Error": {
+					Description: "The error message.",
+					Content: map[string]OpenAPIMediaType{
+						"text/plain": {Schema: JSONSchema{"type": "string"}},
+					},
+				},
+			},
+			SecuritySchemes: map[string]OpenAPISecurityScheme{
+				bearerAuthScheme: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+
+	for _, route := range r.Routes() {
+		path, params := openAPIPath(route.Path)
+
+		op := &OpenAPIOperation{
+			OperationID: openAPIOperationID(route),
+			Responses:   make(map[string]*OpenAPIResponse),
+		}
+
+		if binding, ok := bindings[route.Method+" "+route.Path]; ok {
+			doc.describeBinding(op, binding, params)
+		} else {
+			for _, name := range params {
+				op.Parameters = append(op.Parameters, OpenAPIParameter{
+					Name:     name,
+					In:       "path",
+					Required: true,
+					Schema:   JSONSchema{"type": "string"},
+				})
+			}
+			op.Responses["200"] = &OpenAPIResponse{Description: "OK"}
+		}
+
+		permission, ok := permissions[route.Method+" "+route.Path]
+		for _, s := range secured {
+			if !ok && (route.Path == s.prefix || strings.HasPrefix(route.Path, strings.TrimSuffix(s.prefix, "/")+"/")) {
+				permission, ok = s.permission, true
+			}
+		}
+		if ok {
+			op.Security = []map[string][]string{{bearerAuthScheme: {permission}}}
+			op.Responses["403"] = &OpenAPIResponse{Ref: "#/components/responses/Error"}
+		}
+		if op.Security == nil && authenticated[route.Method+" "+route.Path] {
+			op.Security = []map[string][]string{{bearerAuthScheme: {}}}
+		}
+		if op.Security != nil {
+			op.Responses["401"] = &OpenAPIResponse{Ref: "#/components/responses/Error"}
+		}
+		op.Responses["default"] = &OpenAPIResponse{Ref: "#/components/responses/Error"}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*OpenAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	return doc, nil
+}
+
+func (doc *OpenAPIDocument) describeBinding(op *OpenAPIOperation, binding gatewayBinding, params []string) {
+	method := binding.method
+	input := method.Input()
+
+	op.OperationID = string(method.Name())
+	op.Tags = []string{string(method.Parent().FullName())}
+
+	bound := make(map[string]bool)
+	for _, name := range params {
+		schema := JSONSchema{"type": "string"}
+		if fd := fieldByPath(input, name); fd != nil {
+			schema = doc.fieldSchema(fd)
+		}
+
+		op.Parameters = append(op.Parameters, OpenAPIParameter{Name: name, In: "path", Required: true, Schema: schema})
+		bound[name] = true
+	}
+
+	switch binding.body {
+	case "":
+		for i := 0; i < input.Fields().Len(); i++ {
+			fd := input.Fields().Get(i)
+			if bound[string(fd.Name())] || fd.IsMap() || fd.Message() != nil {
+				continue
+			}
+
+			op.Parameters = append(op.Parameters, OpenAPIParameter{Name: string(fd.Name()), In: "query", Schema: doc.fieldSchema(fd)})
+		}
+	case "*":
+		op.RequestBody = &OpenAPIRequestBody{Required: true, Content: messageContent(doc.messageSchema(input))}
+	default:
+		if fd := input.Fields().ByName(protoreflect.Name(binding.body)); fd != nil {
+			op.RequestBody = &OpenAPIRequestBody{Required: true, Content: messageContent(doc.fieldSchema(fd))}
+		}
+	}
+
+	op.Responses["200"] = &OpenAPIResponse{Description: "OK", Content: messageContent(doc.messageSchema(method.Output()))}
+	op.Responses["400"] = &OpenAPIResponse{Ref: "#/components/responses/Error"}
+}
+
+// messageSchema returns a reference to the schema of desc, adding it to the
+// components on first use.
+func (doc *OpenAPIDocument) messageSchema(desc protoreflect.MessageDescriptor) JSONSchema {
+	switch desc.FullName() {
+	case "google.protobuf.Timestamp":
+		return JSONSchema{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration":
+		return JSONSchema{"type": "string", "pattern": `^-?[0-9]+(\.[0-9]+)?s$`}
+	}
+
+	name := string(desc.FullName())
+	ref := JSONSchema{"$ref": schemaRefPrefix + name}
+	if _, ok := doc.Components.Schemas[name]; ok {
+		return ref
+	}
+
+	schema := JSONSchema{"type": "object"}
+	doc.Components.Schemas[name] = schema
+
+	properties := make(map[string]JSONSchema)
+	for i := 0; i < desc.Fields().Len(); i++ {
+		fd := desc.Fields().Get(i)
+		name := fd.JSONName()
+		if doc.json.UseProtoNames {
+			name = string(fd.Name())
+		}
+		properties[name] = doc.fieldSchema(fd)
+	}
+	if len(properties) > 0 {
+		schema["properties"] = properties
+	}
+
+	return ref
+}
+
+func (doc *OpenAPIDocument) fieldSchema(fd protoreflect.FieldDescriptor) JSONSchema {
+	if fd.IsMap() {
+		return JSONSchema{"type": "object", "additionalProperties": doc.valueSchema(fd.MapValue())}
+	}
+
+	if fd.IsList() {
+		return JSONSchema{"type": "array", "items": doc.valueSchema(fd)}
+	}
+
+	return doc.valueSchema(fd)
+}
+
+func (doc *OpenAPIDocument) valueSchema(fd protoreflect.FieldDescriptor) JSONSchema {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return doc.messageSchema(fd.Message())
+	case protoreflect.EnumKind:
+		if doc.json.UseEnumNumbers {
+			return JSONSchema{"type": "integer", "format": "int32"}
+		}
+
+		values := fd.Enum().Values()
+		names := make([]string, values.Len())
+		for i := range names {
+			names[i] = string(values.Get(i).Name())
+		}
+		return JSONSchema{"type": "string", "enum": names}
+	case protoreflect.BoolKind:
+		return JSONSchema{"type": "boolean"}
+	case protoreflect.StringKind:
+		return JSONSchema{"type": "string"}
+	case protoreflect.BytesKind:
+		return JSONSchema{"type": "string", "contentEncoding": "base64"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return JSONSchema{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return JSONSchema{"type": "integer", "format": "uint32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return JSONSchema{"type": "string", "format": "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return JSONSchema{"type": "string", "format": "uint64"}
+	case protoreflect.FloatKind:
+		return JSONSchema{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return JSONSchema{"type": "number", "format": "double"}
+	}
+
+	return JSONSchema{}
+}
+
+// messageContent describes a proto message body, rendered with protojson or
+// sent as binary protobuf.
+func messageContent(schema JSONSchema) map[string]OpenAPIMediaType {
+	return map[string]OpenAPIMediaType{
+		httputils.ContentTypeJSON:     {Schema: schema},
+		httputils.ContentTypeProtobuf: {Schema: JSONSchema{"type": "string", "format": "binary"}},
+	}
+}
+
+func fieldByPath(desc protoreflect.MessageDescriptor, path string) protoreflect.FieldDescriptor {
+	names := strings.Split(path, ".")
+
+	for _, name := range names[:len(names)-1] {
+		fd := desc.Fields().ByName(protoreflect.Name(name))
+		if fd == nil || fd.Message() == nil {
+			return nil
+		}
+		desc = fd.Message()
+	}
+
+	return desc.Fields().ByName(protoreflect.Name(names[len(names)-1]))
+}
+
+// openAPIPath converts a bunrouter route such as /users/:id to an OpenAPI
+// path template, returning the names of its parameters.
+func openAPIPath(route string) (string, []string) {
+	segments := strings.Split(route, "/")
+
+	var params []string
+	for i, segment := range segments {
+		if len(segment) > 1 && (segment[0] == ':' || segment[0] == '*') {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+func openAPIOperationID(route HTTPRoute) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(route.Method))
+
+	for _, word := range strings.FieldsFunc(route.Path, func(r rune) bool {
+		return r == '/' || r == ':' || r == '*' || r == '-' || r == '_' || r == '.'
+	}) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+
+	return b.String()
+}
+
+// redocVersion is the Redoc release loaded from the CDN when the bundle is
+// not vendored.
+const redocVersion = "2.1.5"
+
+// Redoc configures the /docs page. Bundle is the path of a vendored
+// redoc.standalone.js, served along with the page. Without it the page loads
+// redocVersion from the CDN, checked against the Integrity hash when set.
+type Redoc struct {
+	Bundle    string
+	Integrity string
+}
+
+// RegisterOpenAPIRoutes serves the document of r at /openapi.json and, when
+// ui is set, a Redoc page rendering it at /docs.
+func RegisterOpenAPIRoutes(api *OpenAPI, r *Router, ui *Redoc) error {
+	r.GET("/openapi.json", func(w http.ResponseWriter, req bunrouter.Request) error {
+		doc, err := api.Document(r)
+		if err != nil {
+			return err
+		}
+
+		return bunrouter.JSON(w, doc)
+	})
+
+	if ui == nil {
+		return nil
+	}
+
+	script := fmt.Sprintf(`<script src="https://cdn.jsdelivr.net/npm/redoc@%s/bundles/redoc.standalone.js"`, redocVersion)
+	if ui.Integrity != "" {
+		script += fmt.Sprintf(` integrity="%s" crossorigin="anonymous"`, html.EscapeString(ui.Integrity))
+	}
+
+	if ui.Bundle != "" {
+		bundle, err := os.ReadFile(ui.Bundle)
+		if err != nil {
+			return fmt.Errorf("redoc bundle: %w", err)
+		}
+
+		script = `<script src="/docs/redoc.standalone.js"`
+		r.GET("/docs/redoc.standalone.js", func(w http.ResponseWriter, req bunrouter.Request) error {
+			w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			_, err := w.Write(bundle)
+			return err
+		})
+	}
+
+	page := fmt.Sprintf(redocPage, html.EscapeString(api.title), script+"></script>")
+	r.GET("/docs", func(w http.ResponseWriter, req bunrouter.Request) error {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err := io.WriteString(w, page)
+		return err
+	})
+
+	return nil
+}
+
+const redocPage = `<!DOCTYPE html>
+<html>
+<head>
+<title>%s</title>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+<redoc spec-url="/openapi.json"></redoc>
+%s
+</body>
+</html>
+`
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"github.com/uptrace/bunrouter"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIPath(t *testing.T) {
+	tests := []struct {
+		route  string
+		path   string
+		params []string
+	}{
+		{"/users", "/users", nil},
+		{"/users/:id", "/users/{id}", []string{"id"}},
+		{"/users/:userId/permissions", "/users/{userId}/permissions", []string{"userId"}},
+		{"/files/*name", "/files/{name}", []string{"name"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			path, params := openAPIPath(tt.route)
+			if path != tt.path || !reflect.DeepEqual(params, tt.params) {
+				t.Fatalf("openAPIPath = %q %v, want %q %v", path, params, tt.path, tt.params)
+			}
+		})
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	r := NewRouter()
+	pass := func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc { return next }
+	handler := func(w http.ResponseWriter, req bunrouter.Request) error { return nil }
+
+	gateway := []GatewayOption{
+		GatewayAuth(pass, "auth.AuthService.Login"),
+		GatewayPermission(&fakeAuthService{}, "user.manage", "auth.AuthService.AssignRole"),
+	}
+	if err := RegisterGateway(r.Group, &recordingConn{}, "auth.AuthService", gateway...); err != nil {
+		t.Fatal(err)
+	}
+	r.GET("/admin/config", handler)
+	r.GET("/status/:name", handler)
+
+	api := NewOpenAPI("test", "1.0.0")
+	api.AddService("auth.AuthService", gateway...)
+	api.Secure("/admin", "test.manage")
+
+	doc, err := api.Document(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path        string
+		method      string
+		operationID string
+		security    []map[string][]string
+		params      []string
+		body        bool
+	}{
+		{"/auth/login", "post", "Login", nil, nil, true},
+		{"/users", "get", "GetUsers", []map[string][]string{{bearerAuthScheme: {}}}, nil, false},
+		{"/users/{id}", "put", "UpdateUser", []map[string][]string{{bearerAuthScheme: {}}}, []string{"id"}, true},
+		{"/users/{userId}/permissions", "get", "GetUserPermissions", []map[string][]string{{bearerAuthScheme: {}}}, []string{"userId"}, false},
+		{"/auth/roles", "get", "GetRoles", []map[string][]string{{bearerAuthScheme: {}}}, nil, false},
+		{"/users/roles", "post", "AssignRole", []map[string][]string{{bearerAuthScheme: {"user.manage"}}}, nil, true},
+		{"/admin/config", "get", "getAdminConfig", []map[string][]string{{bearerAuthScheme: {"test.manage"}}}, nil, false},
+		{"/status/{name}", "get", "getStatusName", nil, []string{"name"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			op := doc.Paths[tt.path][tt.method]
+			if op == nil {
+				t.Fatalf("missing operation")
+			}
+
+			if op.OperationID != tt.operationID {
+				t.Fatalf("operationId = %q, want %q", op.OperationID, tt.operationID)
+			}
+			if !reflect.DeepEqual(op.Security, tt.security) {
+				t.Fatalf("security = %v, want %v", op.Security, tt.security)
+			}
+			if _, ok := op.Responses["401"]; ok != (tt.security != nil) {
+				t.Fatalf("401 response = %v, want %v", ok, tt.security != nil)
+			}
+
+			var params []string
+			for _, p := range op.Parameters {
+				if p.In == "path" {
+					params = append(params, p.Name)
+				}
+			}
+			if !reflect.DeepEqual(params, tt.params) {
+				t.Fatalf("path parameters = %v, want %v", params, tt.params)
+			}
+
+			if (op.RequestBody != nil) != tt.body {
+				t.Fatalf("request body = %v, want %v", op.RequestBody != nil, tt.body)
+			}
+		})
+	}
+
+	if _, ok := doc.Components.Schemas["auth.UpdateUserRequest"]; !ok {
+		t.Fatalf("expected the request schemas in the components, got %v", reflect.ValueOf(doc.Components.Schemas).MapKeys())
+	}
+}
+
+func TestRedocPage(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "redoc.standalone.js")
+	if err := os.WriteFile(bundle, []byte("// redoc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		ui     *Redoc
+		script string
+	}{
+		{"pinned", &Redoc{}, `src="https://cdn.jsdelivr.net/npm/redoc@` + redocVersion + `/bundles/redoc.standalone.js"></script>`},
+		{"integrity", &Redoc{Integrity: "sha384-abc"}, `integrity="sha384-abc" crossorigin="anonymous"`},
+		{"vendored", &Redoc{Bundle: bundle}, `src="/docs/redoc.standalone.js"></script>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			if err := RegisterOpenAPIRoutes(NewOpenAPI("test", "1.0.0"), r, tt.ui); err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+			if !strings.Contains(w.Body.String(), tt.script) {
+				t.Fatalf("page = %s, want %s", w.Body.String(), tt.script)
+			}
+		})
+	}
+
+	r := NewRouter()
+	if err := RegisterOpenAPIRoutes(NewOpenAPI("test", "1.0.0"), r, &Redoc{Bundle: bundle}); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/redoc.standalone.js", nil))
+	if w.Body.String() != "// redoc" {
+		t.Fatalf("bundle = %q, want the vendored file", w.Body.String())
+	}
+
+	if err := RegisterOpenAPIRoutes(NewOpenAPI("test", "1.0.0"), NewRouter(), &Redoc{Bundle: bundle + ".missing"}); err == nil {
+		t.Fatalf("expected an error for a missing bundle")
+	}
+}
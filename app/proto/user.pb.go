@@ -7,6 +7,7 @@
 package proto
 
 import (
+	_ "google.golang.org/genproto/googleapis/api/annotations"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	emptypb "google.golang.org/protobuf/types/known/emptypb"
@@ -1790,7 +1791,7 @@ var File_app_proto_user_proto protoreflect.FileDescriptor
 
 const file_app_proto_user_proto_rawDesc = "" +
 	"\n" +
-	"\x14app/proto/user.proto\x12\x04auth\x1a\x1bgoogle/protobuf/empty.proto\"3\n" +
+	"\x14app/proto/user.proto\x12\x04auth\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1cgoogle/api/annotations.proto\"3\n" +
 	"\x19GetUserPermissionsRequest\x12\x16\n" +
 	"\x06userId\x18\x01 \x01(\x03R\x06userId\"\x9d\x01\n" +
 	"\x1aGetUserPermissionsResponse\x12D\n" +
@@ -1903,28 +1904,28 @@ const file_app_proto_user_proto_rawDesc = "" +
 	"\x05ADMIN\x10\x01\x12\n" +
 	"\n" +
 	"\x06DOCKER\x10\x02\x12\v\n" +
-	"\aPACKAGE\x10\x032\xb0\b\n" +
-	"\vAuthService\x122\n" +
-	"\x05Login\x12\x12.auth.LoginRequest\x1a\x13.auth.LoginResponse\"\x00\x12;\n" +
-	"\bRegister\x12\x15.auth.RegisterRequest\x1a\x16.auth.RegisterResponse\"\x00\x12;\n" +
-	"\bValidate\x12\x15.auth.ValidateRequest\x1a\x16.auth.ValidateResponse\"\x00\x12<\n" +
-	"\bGetUsers\x12\x16.google.protobuf.Empty\x1a\x16.auth.GetUsersResponse\"\x00\x128\n" +
-	"\aGetUser\x12\x14.auth.GetUserRequest\x1a\x15.auth.GetUserResponse\"\x00\x12A\n" +
+	"\aPACKAGE\x10\x032\xa1\v\n" +
+	"\vAuthService\x12H\n" +
+	"\x05Login\x12\x12.auth.LoginRequest\x1a\x13.auth.LoginResponse\"\x16\x82\xd3\xe4\x93\x02\x10:\x01*\"\v/auth/login\x12T\n" +
+	"\bRegister\x12\x15.auth.RegisterRequest\x1a\x16.auth.RegisterResponse\"\x19\x82\xd3\xe4\x93\x02\x13:\x01*\"\x0e/auth/register\x12T\n" +
+	"\bValidate\x12\x15.auth.ValidateRequest\x1a\x16.auth.ValidateResponse\"\x19\x82\xd3\xe4\x93\x02\x13:\x01*\"\x0e/auth/validate\x12J\n" +
+	"\bGetUsers\x12\x16.google.protobuf.Empty\x1a\x16.auth.GetUsersResponse\"\x0e\x82\xd3\xe4\x93\x02\b\x12\x06/users\x12K\n" +
+	"\aGetUser\x12\x14.auth.GetUserRequest\x1a\x15.auth.GetUserResponse\"\x13\x82\xd3\xe4\x93\x02\r\x12\v/users/{id}\x12R\n" +
 	"\n" +
-	"CreateUser\x12\x17.auth.CreateUserRequest\x1a\x18.auth.CreateUserResponse\"\x00\x12A\n" +
+	"CreateUser\x12\x17.auth.CreateUserRequest\x1a\x18.auth.CreateUserResponse\"\x11\x82\xd3\xe4\x93\x02\v:\x01*\"\x06/users\x12W\n" +
 	"\n" +
-	"UpdateUser\x12\x17.auth.UpdateUserRequest\x1a\x18.auth.UpdateUserResponse\"\x00\x12A\n" +
+	"UpdateUser\x12\x17.auth.UpdateUserRequest\x1a\x18.auth.UpdateUserResponse\"\x16\x82\xd3\xe4\x93\x02\x10:\x01*\x1a\v/users/{id}\x12T\n" +
 	"\n" +
-	"DeleteUser\x12\x17.auth.DeleteUserRequest\x1a\x18.auth.DeleteUserResponse\"\x00\x12Y\n" +
-	"\x12GetUserPermissions\x12\x1f.auth.GetUserPermissionsRequest\x1a .auth.GetUserPermissionsResponse\"\x00\x12<\n" +
-	"\bGetRoles\x12\x16.google.protobuf.Empty\x1a\x16.auth.GetRolesResponse\"\x00\x12A\n" +
+	"DeleteUser\x12\x17.auth.DeleteUserRequest\x1a\x18.auth.DeleteUserResponse\"\x13\x82\xd3\xe4\x93\x02\r*\v/users/{id}\x12|\n" +
+	"\x12GetUserPermissions\x12\x1f.auth.GetUserPermissionsRequest\x1a .auth.GetUserPermissionsResponse\"#\x82\xd3\xe4\x93\x02\x1d\x12\x1b/users/{userId}/permissions\x12O\n" +
+	"\bGetRoles\x12\x16.google.protobuf.Empty\x1a\x16.auth.GetRolesResponse\"\x13\x82\xd3\xe4\x93\x02\r\x12\v/auth/roles\x12W\n" +
 	"\n" +
-	"CreateRole\x12\x17.auth.CreateRoleRequest\x1a\x18.auth.CreateRoleResponse\"\x00\x12A\n" +
+	"CreateRole\x12\x17.auth.CreateRoleRequest\x1a\x18.auth.CreateRoleResponse\"\x16\x82\xd3\xe4\x93\x02\x10:\x01*\"\v/auth/roles\x12X\n" +
 	"\n" +
-	"AssignRole\x12\x17.auth.AssignRoleRequest\x1a\x18.auth.AssignRoleResponse\"\x00\x12B\n" +
-	"\vGetServices\x12\x16.google.protobuf.Empty\x1a\x19.auth.GetServicesResponse\"\x00\x12b\n" +
-	"\x15GetServicePermissions\x12\".auth.GetServicePermissionsRequest\x1a#.auth.GetServicePermissionsResponse\"\x00\x12k\n" +
-	"\x18CreateServicePermissions\x12%.auth.CreateServicePermissionsRequest\x1a&.auth.CreateServicePermissionsResponse\"\x00B2Z0github.com/alpha-omega-corp/cloud/user/pkg/protob\x06proto3"
+	"AssignRole\x12\x17.auth.AssignRoleRequest\x1a\x18.auth.AssignRoleResponse\"\x17\x82\xd3\xe4\x93\x02\x11:\x01*\"\f/users/roles\x12X\n" +
+	"\vGetServices\x12\x16.google.protobuf.Empty\x1a\x19.auth.GetServicesResponse\"\x16\x82\xd3\xe4\x93\x02\x10\x12\x0e/auth/services\x12\x90\x01\n" +
+	"\x15GetServicePermissions\x12\".auth.GetServicePermissionsRequest\x1a#.auth.GetServicePermissionsResponse\".\x82\xd3\xe4\x93\x02(\x12&/auth/services/{serviceId}/permissions\x12\x90\x01\n" +
+	"\x18CreateServicePermissions\x12%.auth.CreateServicePermissionsRequest\x1a&.auth.CreateServicePermissionsResponse\"%\x82\xd3\xe4\x93\x02\x1f:\x01*\"\x1a/auth/services/permissionsB2Z0github.com/alpha-omega-corp/cloud/user/pkg/protob\x06proto3"
 
 var (
 	file_app_proto_user_proto_rawDescOnce sync.Once
@@ -0,0 +1,207 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/uptrace/bun"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	QueryLogOff     = "off"
+	QueryLogSlow    = "slow"
+	QueryLogVerbose = "verbose"
+)
+
+const redactedValue = "'[REDACTED]'"
+
+var (
+	assignmentPattern = regexp.MustCompile(`"?(\w+)"?(\s*=\s*)'(?:[^']|'')*'`)
+	insertPattern     = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+\S+(?:\s+AS\s+\S+)?\s*\(([^)]*)\)\s*VALUES\s*`)
+)
+
+type QueryLogConfig struct {
+	Mode          string        `mapstructure:"mode" validate:"omitempty,oneof=off slow verbose"`
+	SlowThreshold time.Duration `mapstructure:"slow_threshold" validate:"omitempty,min=0s"`
+	Redact        []string      `mapstructure:"redact"`
+}
+
+type QueryLogHook struct {
+	mode      string
+	threshold time.Duration
+	redact    map[string]bool
+}
+
+var _ bun.QueryHook = (*QueryLogHook)(nil)
+
+func NewQueryLogHook(config QueryLogConfig) *QueryLogHook {
+	redact := map[string]bool{
+		"password":           true,
+		"encrypted_password": true,
+	}
+	for _, column := range config.Redact {
+		redact[strings.ToLower(column)] = true
+	}
+
+	mode := config.Mode
+	if mode == "" {
+		mode = QueryLogOff
+	}
+
+	threshold := config.SlowThreshold
+	if threshold <= 0 {
+		threshold = 200 * time.Millisecond
+	}
+
+	return &QueryLogHook{
+		mode:      mode,
+		threshold: threshold,
+		redact:    redact,
+	}
+}
+
+func (h *QueryLogHook) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *QueryLogHook) AfterQuery(_ context.Context, event *bun.QueryEvent) {
+	duration := time.Since(event.StartTime)
+	failed := event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows)
+
+	switch h.mode {
+	case QueryLogVerbose:
+	case QueryLogSlow:
+		if duration < h.threshold && !failed {
+			return
+		}
+	default:
+		return
+	}
+
+	query := h.Redact(event.Query)
+	if failed {
+		slog.Error("bun query failed", "operation", event.Operation(), "duration", duration.Round(time.Microsecond), "query", query, "error", event.Err)
+		return
+	}
+
+	slog.Info("bun query", "operation", event.Operation(), "duration", duration.Round(time.Microsecond), "query", query)
+}
+
+// Redact replaces the literal values bound to sensitive columns in
+// assignments, comparisons and INSERT value lists.
+func (h *QueryLogHook) Redact(query string) string {
+	query = h.redactAssignments(query)
+
+	loc := insertPattern.FindStringSubmatchIndex(query)
+	if loc == nil {
+		return query
+	}
+
+	var sensitive []bool
+	found := false
+	for _, column := range strings.Split(query[loc[2]:loc[3]], ",") {
+		column = strings.ToLower(strings.Trim(strings.TrimSpace(column), `"`))
+		sensitive = append(sensitive, h.redact[column])
+		found = found || h.redact[column]
+	}
+
+	if !found {
+		return query
+	}
+
+	return query[:loc[1]] + redactTuples(query[loc[1]:], sensitive)
+}
+
+func (h *QueryLogHook) redactAssignments(query string) string {
+	var b strings.Builder
+
+	last := 0
+	for _, loc := range assignmentPattern.FindAllStringSubmatchIndex(query, -1) {
+		if !h.redact[strings.ToLower(query[loc[2]:loc[3]])] {
+			continue
+		}
+
+		b.WriteString(query[last:loc[5]])
+		b.WriteString(redactedValue)
+		last = loc[1]
+	}
+
+	b.WriteString(query[last:])
+
+	return b.String()
+}
+
+// redactTuples walks the "(...), (...)" value lists following VALUES and
+// replaces every value whose position is flagged as sensitive.
+func redactTuples(values string, sensitive []bool) string {
+	var b strings.Builder
+
+	depth, index, start := 0, 0, 0
+	quoted := false
+
+	flush := func(end int) {
+		if index < len(sensitive) && sensitive[index] {
+			b.WriteString(leadingSpace(values[start:end]))
+			b.WriteString(redactedValue)
+		} else {
+			b.WriteString(values[start:end])
+		}
+	}
+
+	for i := 0; i < len(values); i++ {
+		ch := values[i]
+
+		if quoted {
+			if ch == '\'' {
+				if i+1 < len(values) && values[i+1] == '\'' {
+					i++
+					continue
+				}
+				quoted = false
+			}
+			continue
+		}
+
+		switch ch {
+		case '\'':
+			quoted = true
+		case '(':
+			depth++
+			if depth == 1 {
+				b.WriteString(values[start : i+1])
+				start, index = i+1, 0
+			}
+		case ')':
+			if depth == 1 {
+				flush(i)
+				start = i
+			}
+			depth--
+		case ',':
+			if depth == 1 {
+				flush(i)
+				b.WriteByte(',')
+				start = i + 1
+				index++
+			}
+		case ' ', '\t', '\n':
+		default:
+			if depth == 0 {
+				b.WriteString(values[start:])
+				return b.String()
+			}
+		}
+	}
+
+	b.WriteString(values[start:])
+
+	return b.String()
+}
+
+func leadingSpace(value string) string {
+	return value[:len(value)-len(strings.TrimLeft(value, " "))]
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/uptrace/bun"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedact(t *testing.T) {
+	h := NewQueryLogHook(QueryLogConfig{Redact: []string{"token"}})
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			"insert",
+			`INSERT INTO "users" ("id", "email", "password") VALUES (DEFAULT, 'ada@example.com', '$2a$10$hash')`,
+			`INSERT INTO "users" ("id", "email", "password") VALUES (DEFAULT, 'ada@example.com', '[REDACTED]')`,
+		},
+		{
+			"insert several tuples",
+			`INSERT INTO "users" ("email", "password", "name") VALUES ('a@example.com', 'one', 'A'), ('b@example.com', 'two', 'B') RETURNING "id"`,
+			`INSERT INTO "users" ("email", "password", "name") VALUES ('a@example.com', '[REDACTED]', 'A'), ('b@example.com', '[REDACTED]', 'B') RETURNING "id"`,
+		},
+		{
+			"insert with alias",
+			`INSERT INTO "users" AS "u" ("encrypted_password") VALUES ('secret')`,
+			`INSERT INTO "users" AS "u" ("encrypted_password") VALUES ('[REDACTED]')`,
+		},
+		{
+			"insert escaped quotes",
+			`INSERT INTO "users" ("password", "name") VALUES ('it''s, (secret)', 'O''Brien')`,
+			`INSERT INTO "users" ("password", "name") VALUES ('[REDACTED]', 'O''Brien')`,
+		},
+		{
+			"insert without sensitive column",
+			`INSERT INTO "roles" ("name") VALUES ('admin')`,
+			`INSERT INTO "roles" ("name") VALUES ('admin')`,
+		},
+		{
+			"update",
+			`UPDATE "users" AS "u" SET "name" = 'ada', "password" = 'secret' WHERE ("u"."id" = 1)`,
+			`UPDATE "users" AS "u" SET "name" = 'ada', "password" = '[REDACTED]' WHERE ("u"."id" = 1)`,
+		},
+		{
+			"update unquoted",
+			`UPDATE users SET password='secret'`,
+			`UPDATE users SET password='[REDACTED]'`,
+		},
+		{
+			"update escaped quotes",
+			`UPDATE "users" SET "password" = 'it''s secret', "name" = 'O''Brien'`,
+			`UPDATE "users" SET "password" = '[REDACTED]', "name" = 'O''Brien'`,
+		},
+		{
+			"qualified comparison",
+			`SELECT * FROM "users" AS "u" WHERE ("u"."encrypted_password" = 'secret')`,
+			`SELECT * FROM "users" AS "u" WHERE ("u"."encrypted_password" = '[REDACTED]')`,
+		},
+		{
+			"configured column",
+			`UPDATE "sessions" SET "TOKEN" = 'abc'`,
+			`UPDATE "sessions" SET "TOKEN" = '[REDACTED]'`,
+		},
+		{
+			"similar column",
+			`UPDATE "users" SET "password_hint" = 'hint', "old_password" = 'old'`,
+			`UPDATE "users" SET "password_hint" = 'hint', "old_password" = 'old'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.Redact(tt.query); got != tt.want {
+				t.Fatalf("Redact =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryLogHookModes(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	query := `UPDATE "users" SET "password" = 'secret'`
+
+	tests := []struct {
+		name     string
+		mode     string
+		duration time.Duration
+		err      error
+		logged   bool
+	}{
+		{"off", QueryLogOff, time.Second, nil, false},
+		{"off failed", QueryLogOff, 0, errors.New("boom"), false},
+		{"default", "", time.Second, nil, false},
+		{"slow fast", QueryLogSlow, 0, nil, false},
+		{"slow slow", QueryLogSlow, time.Second, nil, true},
+		{"slow failed", QueryLogSlow, 0, errors.New("boom"), true},
+		{"verbose", QueryLogVerbose, 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			h := NewQueryLogHook(QueryLogConfig{Mode: tt.mode, SlowThreshold: 100 * time.Millisecond})
+
+			h.AfterQuery(context.Background(), &bun.QueryEvent{Query: query, StartTime: time.Now().Add(-tt.duration), Err: tt.err})
+
+			out := buf.String()
+			if logged := out != ""; logged != tt.logged {
+				t.Fatalf("logged = %v, want %v: %s", logged, tt.logged, out)
+			}
+			if strings.Contains(out, "secret") {
+				t.Fatalf("expected the password to be redacted: %s", out)
+			}
+			if tt.logged && tt.err != nil && !strings.Contains(out, "level=ERROR") {
+				t.Fatalf("expected failed queries at error level: %s", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/resolver"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Running gRPC servers register their address under services/<name>/<address>
+// with a lease kept alive for as long as they serve. Clients dial
+// etcd:///<name> and the resolver follows the instances as they come and go.
+const (
+	registryPrefix = "services/"
+	registryScheme = "etcd"
+	registryTTL    = 10
+)
+
+func serviceKey(name string, addr string) string {
+	return registryPrefix + name + "/" + addr
+}
+
+// Registration keeps an instance registered until Deregister is called.
+type Registration struct {
+	etcd   *clientv3.Client
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu    sync.Mutex
+	lease clientv3.LeaseID
+}
+
+// Register publishes addr as an instance of name in the background. The lease
+// is granted again if it expires, e.g. after etcd was unreachable for longer
+// than its TTL.
+func Register(etcd *clientv3.Client, name string, addr string) *Registration {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &Registration{
+		etcd:   etcd,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go r.run(ctx, name, addr)
+
+	return r
+}
+
+func (r *Registration) run(ctx context.Context, name string, addr string) {
+	defer close(r.done)
+
+	delay := time.Second
+
+	for ctx.Err() == nil {
+		alive, lease, err := registerOnce(ctx, r.etcd, name, addr)
+		if err != nil {
+			slog.Error("service registration error", "service", name, "error", err)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, 30*time.Second)
+			continue
+		}
+
+		r.setLease(lease)
+		delay = time.Second
+		fmt.Printf("service registered > %s at %s\n", name, addr)
+
+		for range alive {
+		}
+
+		// Deregister revokes the lease; otherwise it expired.
+		if ctx.Err() == nil {
+			r.setLease(0)
+		}
+	}
+}
+
+func (r *Registration) setLease(lease clientv3.LeaseID) {
+	r.mu.Lock()
+	r.lease = lease
+	r.mu.Unlock()
+}
+
+// Deregister stops keeping the instance alive and revokes its lease, removing
+// it from the registry before ctx is done.
+func (r *Registration) Deregister(ctx context.Context) error {
+	r.cancel()
+
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	r.mu.Lock()
+	lease := r.lease
+	r.lease = 0
+	r.mu.Unlock()
+
+	if lease == 0 {
+		return nil
+	}
+
+	_, err := r.etcd.Revoke(ctx, lease)
+	return err
+}
+
+func registerOnce(ctx context.Context, etcd *clientv3.Client, name string, addr string) (<-chan *clientv3.LeaseKeepAliveResponse, clientv3.LeaseID, error) {
+	lease, err := etcd.Grant(ctx, registryTTL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if _, err := etcd.Put(ctx, serviceKey(name, addr), addr, clientv3.WithLease(lease.ID)); err != nil {
+		return nil, 0, err
+	}
+
+	alive, err := etcd.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return alive, lease.ID, nil
+}
+
+type etcdResolverBuilder struct {
+	etcd *clientv3.Client
+}
+
+// NewEtcdResolver resolves etcd:///<name> targets to the registered instances
+// of name.
+func NewEtcdResolver(etcd *clientv3.Client) resolver.Builder {
+	return &etcdResolverBuilder{etcd: etcd}
+}
+
+func (b *etcdResolverBuilder) Scheme() string {
+	return registryScheme
+}
+
+func (b *etcdResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &etcdResolver{
+		etcd:      b.etcd,
+		cc:        cc,
+		prefix:    registryPrefix + strings.TrimPrefix(target.Endpoint(), "/") + "/",
+		cancel:    cancel,
+		instances: make(map[string]string),
+	}
+
+	go r.watch(ctx)
+
+	return r, nil
+}
+
+type etcdResolver struct {
+	etcd   *clientv3.Client
+	cc     resolver.ClientConn
+	prefix string
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	instances map[string]string
+}
+
+// watch loads the current instances then follows changes, starting over when
+// the watch fails, e.g. because its revision was compacted.
+func (r *etcdResolver) watch(ctx context.Context) {
+	delay := time.Second
+
+	for ctx.Err() == nil {
+		res, err := r.etcd.Get(ctx, r.prefix, clientv3.WithPrefix())
+		if err != nil {
+			r.cc.ReportError(err)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, 30*time.Second)
+			continue
+		}
+		delay = time.Second
+
+		r.mu.Lock()
+		r.instances = make(map[string]string, len(res.Kvs))
+		for _, kv := range res.Kvs {
+			r.instances[string(kv.Key)] = string(kv.Value)
+		}
+		r.mu.Unlock()
+		r.update()
+
+		for watch := range r.etcd.Watch(ctx, r.prefix, clientv3.WithPrefix(), clientv3.WithRev(res.Header.Revision+1)) {
+			if err := watch.Err(); err != nil {
+				slog.Warn("service watch error", "prefix", r.prefix, "error", err)
+				break
+			}
+
+			r.mu.Lock()
+			for _, event := range watch.Events {
+				if event.Type == clientv3.EventTypeDelete {
+					delete(r.instances, string(event.Kv.Key))
+				} else {
+					r.instances[string(event.Kv.Key)] = string(event.Kv.Value)
+				}
+			}
+			r.mu.Unlock()
+			r.update()
+		}
+	}
+}
+
+func (r *etcdResolver) update() {
+	r.mu.Lock()
+	addrs := make([]string, 0, len(r.instances))
+	for _, addr := range r.instances {
+		addrs = append(addrs, addr)
+	}
+	r.mu.Unlock()
+	sort.Strings(addrs)
+
+	if len(addrs) == 0 {
+		r.cc.ReportError(fmt.Errorf("no instances registered under %s", r.prefix))
+		return
+	}
+
+	state := resolver.State{Addresses: make([]resolver.Address, len(addrs))}
+	for i, addr := range addrs {
+		state.Addresses[i] = resolver.Address{Addr: addr}
+	}
+
+	if err := r.cc.UpdateState(state); err != nil {
+		slog.Warn("service resolver update error", "prefix", r.prefix, "error", err)
+	}
+}
+
+func (r *etcdResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *etcdResolver) Close() {
+	r.cancel()
+}
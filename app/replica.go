@@ -0,0 +1,214 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc"
+	"log/slog"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+type primaryContextKey struct{}
+
+// WithPrimary marks the context so that StorageHandler.Reader returns the
+// primary database instead of a replica.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+func isPrimary(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryContextKey{}).(bool)
+	return forced
+}
+
+type replica struct {
+	db      *bun.DB
+	healthy atomic.Bool
+}
+
+type writesContextKey struct{}
+
+// writeMarker holds the time of the last successful write made with a
+// context, so that later reads with the same context stay on the primary for
+// the sticky window.
+type writeMarker struct {
+	last atomic.Int64
+}
+
+// WithReadYourWrites starts tracking the writes made with ctx. The gRPC
+// server does it for every call, so a call reads back its own writes.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(writesContextKey{}).(*writeMarker); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, writesContextKey{}, new(writeMarker))
+}
+
+// writeTracker records the writes on the primary in the marker of their
+// context.
+type writeTracker struct{}
+
+var _ bun.QueryHook = (*writeTracker)(nil)
+
+func (t *writeTracker) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (t *writeTracker) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	if event.Err != nil {
+		return
+	}
+
+	marker, ok := ctx.Value(writesContextKey{}).(*writeMarker)
+	if !ok {
+		return
+	}
+
+	switch event.Operation() {
+	case "INSERT", "UPDATE", "DELETE", "MERGE", "TRUNCATE":
+		marker.last.Store(time.Now().UnixNano())
+	}
+}
+
+// replicaResolver sends the select queries of the primary to Reader, which
+// picks the database once the query context is known. Locking selects stay on
+// the primary.
+type replicaResolver struct {
+	h *StorageHandler
+}
+
+func (r replicaResolver) ResolveConn(query bun.Query) bun.IConn {
+	if _, ok := query.(*bun.SelectQuery); ok {
+		return readerConn{h: r.h}
+	}
+
+	return nil
+}
+
+// Close is a no-op, StorageHandler.Close closes the replicas.
+func (r replicaResolver) Close() error {
+	return nil
+}
+
+type readerConn struct {
+	h *StorageHandler
+}
+
+// lockingPattern matches the row locking clauses of a select, which must run
+// on the primary.
+var lockingPattern = regexp.MustCompile(`(?i)\bFOR\s+(?:NO\s+KEY\s+UPDATE|UPDATE|KEY\s+SHARE|SHARE)\b`)
+
+func (c readerConn) reader(ctx context.Context, query string) *bun.DB {
+	if lockingPattern.MatchString(query) {
+		return c.h.Database()
+	}
+
+	return c.h.Reader(ctx)
+}
+
+func (c readerConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.reader(ctx, query).DB.QueryContext(ctx, query, args...)
+}
+
+func (c readerConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.h.Database().DB.ExecContext(ctx, query, args...)
+}
+
+func (c readerConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.reader(ctx, query).DB.QueryRowContext(ctx, query, args...)
+}
+
+// Reader returns a healthy replica chosen round-robin, or the primary when no
+// replica is configured or healthy, the context asks for it, or a write was
+// made with the context within the sticky window. Select queries built from
+// Database go through it.
+func (h *StorageHandler) Reader(ctx context.Context) *bun.DB {
+	primary := h.Database()
+
+	if len(h.replicas) == 0 || isPrimary(ctx) || h.recentWrite(ctx) {
+		return primary
+	}
+
+	count := uint64(len(h.replicas))
+	start := h.next.Add(1)
+
+	for i := uint64(0); i < count; i++ {
+		r := h.replicas[(start+i)%count]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+
+	return primary
+}
+
+func (h *StorageHandler) NewSelect(ctx context.Context) *bun.SelectQuery {
+	return h.Reader(ctx).NewSelect()
+}
+
+func (h *StorageHandler) RunInTx(ctx context.Context, fn func(ctx context.Context, tx bun.Tx) error) error {
+	return h.Database().RunInTx(WithPrimary(ctx), nil, fn)
+}
+
+func (h *StorageHandler) recentWrite(ctx context.Context) bool {
+	if h.config.StickyWindow <= 0 {
+		return false
+	}
+
+	marker, ok := ctx.Value(writesContextKey{}).(*writeMarker)
+	if !ok {
+		return false
+	}
+
+	last := marker.last.Load()
+	return last > 0 && time.Since(time.Unix(0, last)) < h.config.StickyWindow
+}
+
+func readYourWritesUnaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(WithReadYourWrites(ctx), req)
+}
+
+func readYourWritesStreamInterceptor(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: ss, ctx: WithReadYourWrites(ss.Context())})
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func (h *StorageHandler) watchReplicas(done <-chan struct{}) {
+	interval := h.config.HealthInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			for index, r := range h.replicas {
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				err := r.db.PingContext(ctx)
+				cancel()
+
+				healthy := err == nil
+				if r.healthy.Swap(healthy) != healthy {
+					slog.Warn("replica health changed", "replica", index, "healthy", healthy, "error", err)
+				}
+			}
+		}
+	}
+}
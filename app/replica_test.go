@@ -0,0 +1,246 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"github.com/uptrace/bun/migrate"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDB(dsn string, opts ...bun.DBOption) *bun.DB {
+	return bun.NewDB(sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn))), pgdialect.New(), opts...)
+}
+
+func newTestStorage(replicas int, window time.Duration) *StorageHandler {
+	h := &StorageHandler{config: StorageConfig{StickyWindow: window}}
+
+	h.dbOnce.Do(func() {
+		h.db = newTestDB("postgres://primary/app", bun.WithConnResolver(replicaResolver{h: h}))
+		for i := 0; i < replicas; i++ {
+			r := &replica{db: newTestDB("postgres://replica/app")}
+			r.healthy.Store(true)
+			h.replicas = append(h.replicas, r)
+		}
+	})
+
+	return h
+}
+
+func TestReaderRoundRobin(t *testing.T) {
+	h := newTestStorage(2, 0)
+
+	first := h.Reader(context.Background())
+	second := h.Reader(context.Background())
+	if first == h.db || second == h.db || first == second {
+		t.Fatalf("expected both replicas in turn")
+	}
+
+	h.replicas[0].healthy.Store(false)
+	h.replicas[1].healthy.Store(false)
+	if h.Reader(context.Background()) != h.db {
+		t.Fatalf("expected the primary without a healthy replica")
+	}
+}
+
+func TestReaderPrimary(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas int
+		ctx      func() context.Context
+		primary  bool
+	}{
+		{"no replica", 0, context.Background, true},
+		{"replica", 1, context.Background, false},
+		{"forced", 1, func() context.Context { return WithPrimary(context.Background()) }, true},
+		{"tracked without write", 1, func() context.Context { return WithReadYourWrites(context.Background()) }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestStorage(tt.replicas, time.Minute)
+
+			if got := h.Reader(tt.ctx()) == h.db; got != tt.primary {
+				t.Fatalf("primary = %v, want %v", got, tt.primary)
+			}
+		})
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	h := newTestStorage(1, time.Minute)
+	tracker := &writeTracker{}
+
+	writer := WithReadYourWrites(context.Background())
+	other := WithReadYourWrites(context.Background())
+
+	tracker.AfterQuery(writer, &bun.QueryEvent{Query: "SELECT 1"})
+	if h.Reader(writer) == h.db {
+		t.Fatalf("a select must not pin the context to the primary")
+	}
+
+	tracker.AfterQuery(writer, &bun.QueryEvent{Query: "INSERT INTO users DEFAULT VALUES"})
+	if h.Reader(writer) != h.db {
+		t.Fatalf("expected the primary after a write with the same context")
+	}
+
+	if h.Reader(other) == h.db {
+		t.Fatalf("a write must not pin other contexts to the primary")
+	}
+
+	expired := newTestStorage(1, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if expired.Reader(writer) == expired.db {
+		t.Fatalf("expected a replica once the sticky window is over")
+	}
+}
+
+func TestReplicaResolver(t *testing.T) {
+	h := newTestStorage(1, 0)
+	resolver := replicaResolver{h: h}
+
+	if _, ok := resolver.ResolveConn(h.db.NewSelect()).(readerConn); !ok {
+		t.Fatalf("expected select queries to go through the reader")
+	}
+
+	if conn := resolver.ResolveConn(h.db.NewInsert()); conn != nil {
+		t.Fatalf("expected inserts on the primary, got %T", conn)
+	}
+}
+
+func TestReaderLockingSelect(t *testing.T) {
+	h := newTestStorage(1, 0)
+	conn := readerConn{h: h}
+
+	tests := []struct {
+		query   string
+		primary bool
+	}{
+		{`SELECT * FROM "users"`, false},
+		{`SELECT * FROM "users" WHERE "id" = 1 FOR UPDATE`, true},
+		{`SELECT * FROM "users" FOR NO KEY UPDATE SKIP LOCKED`, true},
+		{`SELECT * FROM "users" for share`, true},
+		{`SELECT * FROM "users" FOR KEY SHARE NOWAIT`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := conn.reader(context.Background(), tt.query) == h.db; got != tt.primary {
+				t.Fatalf("primary = %v, want %v", got, tt.primary)
+			}
+		})
+	}
+}
+
+// recordingConnector is a database/sql driver that records the statements it
+// receives and answers them with no rows.
+type recordingConnector struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (c *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return recordingSQLConn{c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver {
+	return nil
+}
+
+func (c *recordingConnector) record(query string) {
+	c.mu.Lock()
+	c.queries = append(c.queries, query)
+	c.mu.Unlock()
+}
+
+func (c *recordingConnector) recorded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.queries...)
+}
+
+type recordingSQLConn struct {
+	c *recordingConnector
+}
+
+func (c recordingSQLConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c recordingSQLConn) Close() error {
+	return nil
+}
+
+func (c recordingSQLConn) Begin() (driver.Tx, error) {
+	return recordingSQLTx{}, nil
+}
+
+func (c recordingSQLConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.c.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c recordingSQLConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.c.record(query)
+	return emptyRows{}, nil
+}
+
+type recordingSQLTx struct{}
+
+func (recordingSQLTx) Commit() error   { return nil }
+func (recordingSQLTx) Rollback() error { return nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func TestMigratorUsesPrimary(t *testing.T) {
+	primary, reader := &recordingConnector{}, &recordingConnector{}
+
+	h := &StorageHandler{}
+	h.dbOnce.Do(func() {
+		h.db = bun.NewDB(sql.OpenDB(primary), pgdialect.New(), bun.WithConnResolver(replicaResolver{h: h}))
+		r := &replica{db: bun.NewDB(sql.OpenDB(reader), pgdialect.New())}
+		r.healthy.Store(true)
+		h.replicas = append(h.replicas, r)
+	})
+
+	var ids []int64
+	if err := h.Database().NewSelect().TableExpr("users").Column("id").Scan(context.Background(), &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.recorded()) != 1 {
+		t.Fatalf("expected the application selects on the replica, got %v", reader.recorded())
+	}
+
+	app := &App{dbHandler: h, migrations: migrate.NewMigrations(), authTables: true}
+	ctx := context.Background()
+	migrator := app.newMigrator(ctx)
+
+	if _, err := migrator.MigrationsWithStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := reader.recorded(); len(got) != 1 {
+		t.Fatalf("expected no migrator query on the replica, got %v", got[1:])
+	}
+	if len(primary.recorded()) == 0 {
+		t.Fatalf("expected the migrator queries on the primary")
+	}
+}
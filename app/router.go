@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"github.com/uptrace/bunrouter"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Router wraps the bunrouter router served by HTTP and records the routes
+// registered through it, which bunrouter has no API to list, for the catalog
+// and the OpenAPI document. Routes registered on the underlying router with
+// Bunrouter are recorded once they have been served.
+type Router struct {
+	*Group
+	router *bunrouter.Router
+}
+
+// Group wraps a bunrouter group, recording the routes registered on it and
+// on the groups derived from it.
+type Group struct {
+	group  *bunrouter.Group
+	path   string
+	routes *routeTable
+}
+
+type routeTable struct {
+	mu     sync.Mutex
+	routes []HTTPRoute
+	seen   map[HTTPRoute]bool
+}
+
+func (t *routeTable) add(route HTTPRoute) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.seen[route] {
+		return
+	}
+
+	t.seen[route] = true
+	t.routes = append(t.routes, route)
+}
+
+type methodNotAllowedKey struct{}
+
+// record adds the routes served that were not registered through a Group.
+// Requests for a known path with a method it does not handle are not routes.
+func (t *routeTable) record(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		notAllowed := new(bool)
+		err := next(w, req.WithContext(context.WithValue(req.Context(), methodNotAllowedKey{}, notAllowed)))
+
+		if route := req.Route(); route != "" && !*notAllowed {
+			t.add(HTTPRoute{Method: req.Method, Path: route})
+		}
+
+		return err
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, req bunrouter.Request) error {
+	if notAllowed, ok := req.Context().Value(methodNotAllowedKey{}).(*bool); ok {
+		*notAllowed = true
+	}
+
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	return nil
+}
+
+func NewRouter(opts ...bunrouter.Option) *Router {
+	routes := &routeTable{seen: make(map[HTTPRoute]bool)}
+	r := bunrouter.New(append([]bunrouter.Option{
+		bunrouter.WithMethodNotAllowedHandler(methodNotAllowed),
+		bunrouter.Use(routes.record),
+	}, opts...)...)
+
+	return &Router{
+		Group:  &Group{group: &r.Group, routes: routes},
+		router: r,
+	}
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.router.ServeHTTP(w, req)
+}
+
+// Bunrouter returns the wrapped router. Routes registered on it are listed
+// once they have been served.
+func (r *Router) Bunrouter() *bunrouter.Router {
+	return r.router
+}
+
+// Routes lists the recorded routes, sorted by path then method.
+func (r *Router) Routes() []HTTPRoute {
+	r.routes.mu.Lock()
+	routes := append([]HTTPRoute(nil), r.routes.routes...)
+	r.routes.mu.Unlock()
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes
+}
+
+func (g *Group) derive(group *bunrouter.Group, path string) *Group {
+	return &Group{group: group, path: g.path + path, routes: g.routes}
+}
+
+func (g *Group) NewGroup(path string, opts ...bunrouter.GroupOption) *Group {
+	return g.derive(g.group.NewGroup(path, opts...), path)
+}
+
+func (g *Group) Use(middlewares ...bunrouter.MiddlewareFunc) *Group {
+	return g.derive(g.group.Use(middlewares...), "")
+}
+
+func (g *Group) WithMiddleware(middleware bunrouter.MiddlewareFunc) *Group {
+	return g.derive(g.group.WithMiddleware(middleware), "")
+}
+
+func (g *Group) WithGroup(path string, fn func(g *Group)) {
+	fn(g.NewGroup(path))
+}
+
+func (g *Group) Handle(method string, path string, handler bunrouter.HandlerFunc) {
+	g.group.Handle(method, path, handler)
+	g.routes.add(HTTPRoute{Method: method, Path: g.path + path})
+}
+
+func (g *Group) GET(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodGet, path, handler)
+}
+
+func (g *Group) POST(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodPost, path, handler)
+}
+
+func (g *Group) PUT(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodPut, path, handler)
+}
+
+func (g *Group) DELETE(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodDelete, path, handler)
+}
+
+func (g *Group) PATCH(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodPatch, path, handler)
+}
+
+func (g *Group) HEAD(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodHead, path, handler)
+}
+
+func (g *Group) OPTIONS(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodOptions, path, handler)
+}
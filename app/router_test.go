@@ -0,0 +1,73 @@
+package app
+
+import (
+	"github.com/uptrace/bunrouter"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouterRecordsRoutes(t *testing.T) {
+	r := NewRouter()
+	handler := func(w http.ResponseWriter, req bunrouter.Request) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	r.GET("/users/:id", handler)
+	admin := r.Use(func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc { return next })
+	admin.WithGroup("/admin", func(g *Group) {
+		g.POST("/flags", handler)
+		g.NewGroup("/config").DELETE("/:key", handler)
+	})
+
+	want := []HTTPRoute{
+		{Method: http.MethodDelete, Path: "/admin/config/:key"},
+		{Method: http.MethodPost, Path: "/admin/flags"},
+		{Method: http.MethodGet, Path: "/users/:id"},
+	}
+	if got := r.Routes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Routes = %v, want %v", got, want)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/config/url", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want the route to be served", w.Code)
+	}
+}
+
+func TestRouterRecordsServedRoutes(t *testing.T) {
+	r := NewRouter()
+	r.GET("/users", func(w http.ResponseWriter, req bunrouter.Request) error { return nil })
+	r.Bunrouter().GET("/legacy/:id", func(w http.ResponseWriter, req bunrouter.Request) error { return nil })
+
+	if got := r.Routes(); len(got) != 1 {
+		t.Fatalf("Routes = %v, want only the route registered through the router", got)
+	}
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/legacy/7", nil),
+		httptest.NewRequest(http.MethodGet, "/missing", nil),
+		httptest.NewRequest(http.MethodGet, "/legacy/7", nil),
+		httptest.NewRequest(http.MethodGet, "/legacy/8", nil),
+		httptest.NewRequest(http.MethodGet, "/users", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	want := []HTTPRoute{
+		{Method: http.MethodGet, Path: "/legacy/:id"},
+		{Method: http.MethodGet, Path: "/users"},
+	}
+	if got := r.Routes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Routes = %v, want %v", got, want)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/users", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
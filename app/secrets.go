@@ -0,0 +1,261 @@
+package app
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Secrets are stored as "enc:" followed by the base64 encoded AES-GCM nonce
+// and ciphertext. The 32 byte key is read, base64 encoded, from APP_SECRET_KEY
+// or from the file named by APP_SECRET_KEY_FILE.
+const (
+	encryptedPrefix  = "enc:"
+	secretKeyEnv     = "APP_SECRET_KEY"
+	secretKeyFileEnv = "APP_SECRET_KEY_FILE"
+	redacted         = "[REDACTED]"
+)
+
+var secretKeyPattern = regexp.MustCompile(`(?i)(secret|password|passwd|token|private_key|api_key)`)
+
+func loadSecretKey() ([]byte, error) {
+	encoded := os.Getenv(secretKeyEnv)
+
+	if encoded == "" {
+		path := os.Getenv(secretKeyFileEnv)
+		if path == "" {
+			return nil, fmt.Errorf("no secret key configured, set %s or %s", secretKeyEnv, secretKeyFileEnv)
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read secret key file: %w", err)
+		}
+
+		encoded = strings.TrimSpace(string(raw))
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode secret key: %w", err)
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secret key must be 32 bytes, got %d", len(key))
+	}
+
+	return key, nil
+}
+
+func GenerateSecretKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func DecryptSecret(key []byte, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("ciphertext is too short")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// decryptSecrets replaces every encrypted value in v, including those in
+// lists and nested maps, with its plaintext and returns the keys that held
+// one. The secret key is only loaded when an encrypted value is present.
+func decryptSecrets(v *viper.Viper) (map[string]bool, error) {
+	secrets := make(map[string]bool)
+
+	var key []byte
+	decrypt := func(value string) (string, error) {
+		if key == nil {
+			loaded, err := loadSecretKey()
+			if err != nil {
+				return "", err
+			}
+			key = loaded
+		}
+
+		return DecryptSecret(key, value)
+	}
+
+	for _, name := range v.AllKeys() {
+		value, found, err := decryptValue(v.Get(name), decrypt)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt %s: %w", name, err)
+		}
+
+		if found {
+			v.Set(name, value)
+			secrets[name] = true
+		}
+	}
+
+	return secrets, nil
+}
+
+// decryptValue decrypts value, or the encrypted strings it holds, reporting
+// whether it held any.
+func decryptValue(value any, decrypt func(string) (string, error)) (any, bool, error) {
+	switch value := value.(type) {
+	case string:
+		if !strings.HasPrefix(value, encryptedPrefix) {
+			return value, false, nil
+		}
+
+		plaintext, err := decrypt(value)
+		return plaintext, err == nil, err
+	case []string:
+		items := make([]any, len(value))
+		for i, item := range value {
+			items[i] = item
+		}
+		return decryptValue(items, decrypt)
+	case []any:
+		out := make([]any, len(value))
+		found := false
+		for i, item := range value {
+			decrypted, ok, err := decryptValue(item, decrypt)
+			if err != nil {
+				return nil, false, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i], found = decrypted, found || ok
+		}
+		return out, found, nil
+	case map[string]any:
+		out := make(map[string]any, len(value))
+		found := false
+		for key, item := range value {
+			decrypted, ok, err := decryptValue(item, decrypt)
+			if err != nil {
+				return nil, false, fmt.Errorf("%s: %w", key, err)
+			}
+			out[key], found = decrypted, found || ok
+		}
+		return out, found, nil
+	}
+
+	return value, false, nil
+}
+
+// RedactValue hides the value of secret keys and the password of URLs,
+// including those in lists and nested maps, so configuration can be printed
+// or logged.
+func RedactValue(key string, value any, secrets map[string]bool) any {
+	if secrets[key] || secretKeyPattern.MatchString(key) {
+		return redacted
+	}
+
+	switch value := value.(type) {
+	case string:
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				return u.Redacted()
+			}
+		}
+	case []string:
+		out := make([]any, len(value))
+		for i, item := range value {
+			out[i] = RedactValue(key, item, nil)
+		}
+		return out
+	case []any:
+		out := make([]any, len(value))
+		for i, item := range value {
+			out[i] = RedactValue(key, item, nil)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(value))
+		for name, item := range value {
+			out[name] = RedactValue(key+"."+name, item, nil)
+		}
+		return out
+	}
+
+	return value
+}
+
+// RedactConfig returns a YAML configuration file with the values of secret
+// keys and URL passwords hidden.
+func RedactConfig(raw []byte) ([]byte, error) {
+	var settings map[string]any
+	if err := yaml.Unmarshal(raw, &settings); err != nil {
+		return nil, err
+	}
+
+	for key, value := range settings {
+		settings[key] = RedactValue(key, value, nil)
+	}
+
+	return yaml.Marshal(settings)
+}
+
+// Redacted returns the effective settings with secrets hidden, keyed by
+// dotted path.
+func (c *Config) Redacted() map[string]any {
+	out := make(map[string]any)
+
+	keys := c.Env.AllKeys()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		out[key] = RedactValue(key, c.Env.Get(key), c.secrets)
+	}
+
+	return out
+}
@@ -0,0 +1,227 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dbfixture"
+	"github.com/uptrace/bun/schema"
+	"github.com/urfave/cli/v3"
+	"io/fs"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const fixturesDir = "fixtures"
+
+// authFixtures seed the roles, services, permissions and test users of the
+// tables CreateApi registers. They are loaded before the application fixtures,
+// which may reference their rows, outside production.
+//
+//go:embed fixtures/*.yml
+var authFixtures embed.FS
+
+type fixtureFile struct {
+	fsys fs.FS
+	name string
+}
+
+var errDryRun = errors.New("dry run")
+
+func (app *App) seedCommand() *cli.Command {
+	return app.createCommand("db", "seed", func(ctx context.Context, cmd *cli.Command) {
+		if app.dbHandler == nil {
+			panic("no database configured for application: " + app.name)
+		}
+
+		files, err := app.fixtureFiles(cmd.String("env"))
+		if err != nil {
+			panic(err)
+		}
+
+		if len(files) == 0 {
+			fmt.Println("no fixtures found")
+			return
+		}
+
+		dryRun := cmd.Bool("dry-run")
+
+		err = app.dbHandler.Primary().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			fixture := dbfixture.New(tx, dbfixture.WithBeforeInsert(func(ctx context.Context, data *dbfixture.BeforeInsertData) error {
+				return upsertFixture(ctx, tx, data, dryRun)
+			}))
+
+			for _, file := range files {
+				fmt.Printf("seeding %s\n", file.name)
+
+				if err := fixture.Load(ctx, file.fsys, file.name); err != nil {
+					return fmt.Errorf("load fixture %s: %w", file.name, err)
+				}
+			}
+
+			if dryRun {
+				return errDryRun
+			}
+
+			return nil
+		})
+
+		if errors.Is(err, errDryRun) {
+			fmt.Println("dry run, no changes were committed")
+			return
+		}
+		if err != nil {
+			panic(err)
+		}
+	}, &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "print the changes without committing them",
+	})
+}
+
+// fixtureFiles returns the auth fixtures, then the shared fixtures of the
+// application followed by the ones specific to the environment, each group in
+// lexical order.
+func (app *App) fixtureFiles(env string) ([]fixtureFile, error) {
+	var files []fixtureFile
+
+	if app.authTables && !IsProduction(env) {
+		names, err := fs.Glob(authFixtures, fixturesDir+"/*.yml")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			files = append(files, fixtureFile{fsys: authFixtures, name: name})
+		}
+	}
+
+	for _, dir := range []string{fixturesDir, path.Join(fixturesDir, env)} {
+		entries, err := fs.ReadDir(app.fs, dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			ext := path.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".yml" && ext != ".yaml") {
+				continue
+			}
+
+			files = append(files, fixtureFile{fsys: app.fs, name: path.Join(dir, entry.Name())})
+		}
+	}
+
+	return files, nil
+}
+
+// upsertFixture turns a fixture insert into an upsert on the model's unique
+// key so seeding can run repeatedly, and reports whether the row is new.
+func upsertFixture(ctx context.Context, db bun.IDB, data *dbfixture.BeforeInsertData, dryRun bool) error {
+	table := db.Dialect().Tables().Get(reflect.TypeOf(data.Model).Elem())
+	strct := reflect.ValueOf(data.Model).Elem()
+
+	conflict := conflictFields(table)
+	if len(conflict) == 0 {
+		return fmt.Errorf("fixture model %s has no unique key to upsert on", table.TypeName)
+	}
+
+	exists := db.NewSelect().TableExpr("?", table.SQLName)
+	var keys []string
+	for _, field := range conflict {
+		value := field.Value(strct).Interface()
+
+		exists = exists.Where("? = ?", field.SQLName, value)
+		keys = append(keys, fmt.Sprintf("%s=%v", field.Name, value))
+	}
+
+	found, err := exists.Exists(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	action := "insert"
+	if found {
+		action = "update"
+	}
+
+	prefix := ""
+	if dryRun {
+		prefix = "(dry run) "
+	}
+	fmt.Printf("  %s%s %s (%s)\n", prefix, action, table.Name, strings.Join(keys, ", "))
+
+	data.Query.
+		On(fmt.Sprintf("CONFLICT (%s) DO UPDATE", joinFieldNames(conflict))).
+		Returning("*")
+
+	updated := false
+	for _, field := range table.DataFields {
+		if isConflictField(field, conflict) || field.Name == "created_at" {
+			continue
+		}
+
+		data.Query.Set("? = EXCLUDED.?", field.SQLName, field.SQLName)
+		updated = true
+	}
+
+	if !updated {
+		// DO UPDATE needs at least one assignment to return the existing row.
+		data.Query.Set("? = EXCLUDED.?", conflict[0].SQLName, conflict[0].SQLName)
+	}
+
+	return nil
+}
+
+func conflictFields(table *schema.Table) []*schema.Field {
+	if len(table.Unique) > 0 {
+		names := make([]string, 0, len(table.Unique))
+		for name := range table.Unique {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fields := table.Unique[names[0]]
+		if names[0] == "" {
+			// Unnamed unique tags each declare a single column constraint.
+			return fields[:1]
+		}
+
+		return fields
+	}
+
+	for _, pk := range table.PKs {
+		if pk.AutoIncrement || pk.Identity {
+			return nil
+		}
+	}
+
+	return table.PKs
+}
+
+func isConflictField(field *schema.Field, conflict []*schema.Field) bool {
+	for _, f := range conflict {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+func joinFieldNames(fields []*schema.Field) string {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = string(field.SQLName)
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,234 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"log/slog"
+	"time"
+)
+
+// Applications list the etcd namespaces they import under config_imports, e.g.
+// [shared] to read config_shared. Imported settings sit between the defaults
+// and the embedded file, in the order listed, so an application can override
+// any of them.
+
+const SourceImport = "import"
+
+// loadImports reads the namespaces declared in the configuration merged with
+// remote, the etcd value of the application, so that etcd can declare
+// imports too.
+func (h *ConfigHandler) loadImports(ctx context.Context, remote []byte) error {
+	config, err := h.resolve(remote)
+	if err != nil {
+		return err
+	}
+
+	return h.loadImportNames(ctx, config.Env.GetStringSlice("config_imports"))
+}
+
+func (h *ConfigHandler) loadImportNames(ctx context.Context, names []string) error {
+	imports := make(map[string][]byte, len(names))
+
+	for _, name := range names {
+		raw, err := getRemoteConfig(ctx, h.etcd, name)
+		if err != nil {
+			return fmt.Errorf("import %s: %w", name, err)
+		}
+
+		imports[name] = raw
+	}
+
+	h.mu.Lock()
+	h.importNames = names
+	h.imports = imports
+	h.mu.Unlock()
+
+	return nil
+}
+
+// watchImports reloads the configuration whenever an imported namespace
+// changes.
+func (h *ConfigHandler) watchImports(ctx context.Context) {
+	h.mu.Lock()
+	names := h.importNames
+	h.mu.Unlock()
+
+	for _, name := range names {
+		go watchFrom(ctx, h.etcd, configKey(name), 0, func(events []*clientv3.Event) {
+			for _, event := range events {
+				if event.Type != clientv3.EventTypePut {
+					continue
+				}
+
+				h.reloadImport(name, event.Kv.Value, event.Kv.ModRevision)
+			}
+		}, func(ctx context.Context) (int64, error) {
+			res, err := h.etcd.Get(ctx, configKey(name))
+			if err != nil {
+				return 0, err
+			}
+
+			if len(res.Kvs) > 0 {
+				h.reloadImport(name, res.Kvs[0].Value, res.Kvs[0].ModRevision)
+			}
+
+			return res.Header.Revision, nil
+		})
+	}
+}
+
+func (h *ConfigHandler) reloadImport(name string, raw []byte, revision int64) {
+	h.mu.Lock()
+	h.imports[name] = raw
+	h.mu.Unlock()
+
+	if err := h.reapply(); err != nil {
+		slog.Warn("ignoring invalid configuration", "app", h.name, "error", err)
+		return
+	}
+
+	fmt.Printf("config reloaded > %s (import %s, revision %d)\n", h.name, name, revision)
+}
+
+// importLayers returns one layer per imported namespace, in declaration
+// order.
+func (h *ConfigHandler) importLayers() ([]ConfigLayer, error) {
+	h.mu.Lock()
+	names, imports := h.importNames, h.imports
+	h.mu.Unlock()
+
+	var layers []ConfigLayer
+
+	for _, name := range names {
+		raw, ok := imports[name]
+		if !ok {
+			continue
+		}
+
+		layer, err := settingsLayer(SourceImport+":"+name, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s configuration: %w", configKey(name), err)
+		}
+		layers = append(layers, layer)
+	}
+
+	return layers, nil
+}
+
+// reapply resolves the current etcd value again, after an import changed.
+func (h *ConfigHandler) reapply() error {
+	config := h.GetConfig()
+
+	return h.apply(config.remote, config.revision)
+}
+
+// requestConfig resolves the configuration another application stored in
+// etcd, with its own imports, without the local file, environment or flags.
+// The value read is validated and cached on disk; when etcd is not connected,
+// cannot be read or holds an invalid configuration, the cached copy is used
+// without imports.
+func (h *ConfigHandler) requestConfig(name string) (*Config, error) {
+	if h.etcd != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), requestConfigTimeout)
+		defer cancel()
+
+		config, err := h.fetchConfig(ctx, name)
+		if err == nil {
+			err = validateConfig(config)
+		}
+		if err == nil {
+			h.saveCache(name, config.remote)
+			return config, nil
+		}
+
+		slog.Warn("etcd configuration unavailable", "app", name, "error", err)
+	}
+
+	cached := h.loadCache(name)
+	if cached == nil {
+		return nil, fmt.Errorf("no usable configuration found for %s in etcd or at %s", name, h.cachePath(name))
+	}
+
+	slog.Warn("using cached etcd configuration", "app", name, "path", h.cachePath(name))
+
+	remote, err := settingsLayer(SourceEtcd, cached)
+	if err != nil {
+		return nil, fmt.Errorf("cached configuration %s: %w", h.cachePath(name), err)
+	}
+
+	config, err := remoteConfig([]ConfigLayer{remote})
+	if err == nil {
+		err = validateConfig(config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cached configuration %s: %w", h.cachePath(name), err)
+	}
+	config.remote = cached
+
+	return config, nil
+}
+
+const requestConfigTimeout = 5 * time.Second
+
+func (h *ConfigHandler) fetchConfig(ctx context.Context, name string) (*Config, error) {
+	kv, err := getRemoteValue(ctx, h.etcd, name, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := settingsLayer(SourceEtcd, kv.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := mergeLayers([]ConfigLayer{remote})
+	if err != nil {
+		return nil, err
+	}
+
+	other := &ConfigHandler{name: name, etcd: h.etcd}
+	if err := other.loadImportNames(ctx, v.GetStringSlice("config_imports")); err != nil {
+		return nil, err
+	}
+
+	layers, err := other.importLayers()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := remoteConfig(append(layers, remote))
+	if err != nil {
+		return nil, err
+	}
+
+	config.remote = kv.Value
+	config.revision = kv.ModRevision
+
+	return config, nil
+}
+
+// remoteConfig merges layers over the defaults and decodes the result.
+func remoteConfig(layers []ConfigLayer) (*Config, error) {
+	layers = append([]ConfigLayer{{Source: SourceDefault, Values: flattenSettings("", DefaultSettings, map[string]any{})}}, layers...)
+
+	v, err := mergeLayers(layers)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := decryptSecrets(v)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := decodeConfig(v)
+	if err != nil {
+		return nil, err
+	}
+
+	config.layers = layers
+	config.secrets = secrets
+
+	return config, nil
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequestConfigOffline(t *testing.T) {
+	h := newTestConfigHandler("", WithDefaults(map[string]any{"config_cache_dir": t.TempDir()}))
+	config, err := h.resolve(nil)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	h.config.Store(config)
+
+	if _, err := h.requestConfig("user"); err == nil {
+		t.Fatalf("expected an error without etcd or a cached configuration")
+	}
+
+	h.saveCache("user", []byte("url: localhost:50051\nsecret: s3cr3t\n"))
+
+	user, err := h.requestConfig("user")
+	if err != nil {
+		t.Fatalf("requestConfig: %v", err)
+	}
+
+	if got := *user.Url; got != "localhost:50051" {
+		t.Fatalf("url = %q, want the cached value", got)
+	}
+	if got := user.Env.GetString("log_level"); got != "info" {
+		t.Fatalf("log_level = %q, want the default", got)
+	}
+	if h.cachePath("user") == h.cachePath(h.name) {
+		t.Fatalf("expected one cache file per application")
+	}
+}
+
+func TestRequestConfigValidates(t *testing.T) {
+	tests := []struct {
+		name   string
+		remote string
+		cached string
+		url    string
+		err    bool
+	}{
+		{"valid", "url: localhost:50051\n", "", "localhost:50051", false},
+		{"missing url", "secret: s3cr3t\n", "", "", true},
+		{"missing url with cache", "secret: s3cr3t\n", "url: localhost:50052\n", "localhost:50052", false},
+		{"invalid cache", "", "url: localhost\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			etcd, fake := newFakeEtcd()
+			if tt.remote != "" {
+				if _, err := fake.Put(context.Background(), configKey("user"), tt.remote); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			h := newTestConfigHandler("", WithDefaults(map[string]any{"config_cache_dir": t.TempDir()}))
+			config, err := h.resolve(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.config.Store(config)
+			h.etcd = etcd
+
+			if tt.cached != "" {
+				h.saveCache("user", []byte(tt.cached))
+			}
+
+			user, err := h.requestConfig("user")
+			if (err != nil) != tt.err {
+				t.Fatalf("requestConfig error = %v, want error %v", err, tt.err)
+			}
+			if err == nil && *user.Url != tt.url {
+				t.Fatalf("url = %q, want %q", *user.Url, tt.url)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"log/slog"
+	"time"
+)
+
+// watchFrom watches key from revision rev (the current one when 0) until ctx
+// is done, passing each batch of events to handle. etcd closes a watch when
+// it is cancelled or its revision is compacted, so a new one is started from
+// the next revision. The events lost to a compaction cannot be replayed:
+// resync reloads the current state and returns its revision instead.
+func watchFrom(ctx context.Context, etcd *clientv3.Client, key string, rev int64, handle func([]*clientv3.Event), resync func(context.Context) (int64, error), opts ...clientv3.OpOption) {
+	for {
+		rev = watchOnce(ctx, etcd, key, rev, handle, resync, opts...)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// watchOnce runs a single watch until etcd closes it and returns the revision
+// to resume from.
+func watchOnce(ctx context.Context, etcd *clientv3.Client, key string, rev int64, handle func([]*clientv3.Event), resync func(context.Context) (int64, error), opts ...clientv3.OpOption) int64 {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if rev > 0 {
+		opts = append([]clientv3.OpOption{clientv3.WithRev(rev)}, opts...)
+	}
+
+	for res := range etcd.Watch(clientv3.WithRequireLeader(ctx), key, opts...) {
+		if res.CompactRevision != 0 {
+			slog.Info("watch compacted, resyncing", "key", key, "revision", rev, "compact_revision", res.CompactRevision)
+
+			current, err := resync(ctx)
+			if err != nil {
+				slog.Warn("watch resync error", "key", key, "error", err)
+				return res.CompactRevision
+			}
+
+			return current + 1
+		}
+
+		if err := res.Err(); err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("watch error", "key", key, "error", err)
+			}
+			return rev
+		}
+
+		handle(res.Events)
+		if res.Header.Revision > 0 {
+			rev = res.Header.Revision + 1
+		}
+	}
+
+	return rev
+}
@@ -1,18 +1,65 @@
 package httputils
 
 import (
+	"bufio"
 	"encoding/json"
 	"github.com/uptrace/bunrouter"
-	"log"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 )
 
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// JSONOptions control how proto messages are rendered as JSON.
+type JSONOptions struct {
+	// UseProtoNames uses the proto field names instead of their lowerCamelCase
+	// JSON names.
+	UseProtoNames bool `mapstructure:"use_proto_names"`
+	// EmitUnpopulated renders fields holding their zero value.
+	EmitUnpopulated bool `mapstructure:"emit_unpopulated"`
+	// UseEnumNumbers renders enums as numbers instead of their names.
+	UseEnumNumbers bool `mapstructure:"use_enum_numbers"`
+}
+
+var jsonOptions atomic.Pointer[JSONOptions]
+
+func init() {
+	jsonOptions.Store(&JSONOptions{})
+}
+
+func SetJSONOptions(opts JSONOptions) {
+	jsonOptions.Store(&opts)
+}
+
+func GetJSONOptions() JSONOptions {
+	return *jsonOptions.Load()
+}
+
+// JSON writes res as JSON, or in the format negotiated by
+// NegotiateMiddleware when the route runs behind it.
 func JSON[T any](w http.ResponseWriter, res *T, err error) error {
 	if err != nil {
 		Error(w, err, http.StatusInternalServerError)
 	}
 
-	return bunrouter.JSON(w, res)
+	contentType := ContentTypeJSON
+	if negotiated, ok := negotiatedType(w); ok {
+		w.Header().Add("Vary", "Accept")
+		contentType = negotiated
+	}
+
+	return write(w, contentType, res)
 }
 
 func Response[T any](w http.ResponseWriter, req func() (*T, error)) error {
@@ -20,6 +67,140 @@ func Response[T any](w http.ResponseWriter, req func() (*T, error)) error {
 	return JSON(w, res, err)
 }
 
+// Render writes res in the format the client asked for in its Accept header:
+// protobuf for proto messages when preferred, JSON otherwise.
+func Render(w http.ResponseWriter, req bunrouter.Request, res any) error {
+	w.Header().Add("Vary", "Accept")
+	return write(w, Negotiate(req.Header.Get("Accept")), res)
+}
+
+// NegotiateMiddleware negotiates the response format from the Accept header
+// for JSON and Response, like Render does.
+func NegotiateMiddleware(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		return next(&negotiatedWriter{ResponseWriter: w, contentType: Negotiate(req.Header.Get("Accept"))}, req)
+	}
+}
+
+type negotiatedWriter struct {
+	http.ResponseWriter
+	contentType string
+}
+
+func (w *negotiatedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush and Hijack forward to the wrapped writer so streaming handlers and
+// websocket upgrades keep working behind NegotiateMiddleware.
+func (w *negotiatedWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *negotiatedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// negotiatedType finds the content type negotiated by NegotiateMiddleware,
+// looking through the writers wrapping it.
+func negotiatedType(w http.ResponseWriter) (string, bool) {
+	for {
+		switch rw := w.(type) {
+		case *negotiatedWriter:
+			return rw.contentType, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return "", false
+		}
+	}
+}
+
+// Negotiate picks the response content type for an Accept header, preferring
+// JSON when both are equally acceptable. Each type takes the quality of the
+// most specific range matching it, so q=0 refuses it even when a wildcard
+// accepts it. JSON is the fallback when nothing is acceptable.
+func Negotiate(accept string) string {
+	quality := make(map[string]float64)
+	specificity := make(map[string]int)
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		var types []string
+		var level int
+		switch mediaType {
+		case ContentTypeProtobuf, "application/protobuf":
+			types, level = []string{ContentTypeProtobuf}, 2
+		case ContentTypeJSON:
+			types, level = []string{ContentTypeJSON}, 2
+		case "application/*":
+			types, level = []string{ContentTypeJSON, ContentTypeProtobuf}, 1
+		case "*/*":
+			types, level = []string{ContentTypeJSON, ContentTypeProtobuf}, 0
+		default:
+			continue
+		}
+
+		for _, contentType := range types {
+			if current, ok := specificity[contentType]; !ok || level > current {
+				quality[contentType], specificity[contentType] = q, level
+			}
+		}
+	}
+
+	best, bestQ := ContentTypeJSON, 0.0
+	for _, contentType := range []string{ContentTypeJSON, ContentTypeProtobuf} {
+		if quality[contentType] > bestQ {
+			best, bestQ = contentType, quality[contentType]
+		}
+	}
+
+	return best
+}
+
+func write(w http.ResponseWriter, contentType string, res any) error {
+	msg, ok := res.(proto.Message)
+	if !ok || !msg.ProtoReflect().IsValid() {
+		return bunrouter.JSON(w, res)
+	}
+
+	var data []byte
+	var err error
+	if contentType == ContentTypeProtobuf {
+		data, err = proto.Marshal(msg)
+	} else {
+		data, err = marshalJSON(msg)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, err = w.Write(data)
+	return err
+}
+
+func marshalJSON(msg proto.Message) ([]byte, error) {
+	opts := GetJSONOptions()
+
+	return protojson.MarshalOptions{
+		UseProtoNames:   opts.UseProtoNames,
+		EmitUnpopulated: opts.EmitUnpopulated,
+		UseEnumNumbers:  opts.UseEnumNumbers,
+	}.Marshal(msg)
+}
+
 func GetParams[T any](w http.ResponseWriter, req bunrouter.Request) *T {
 	params, err := json.Marshal(req.Params().Map())
 	if err != nil {
@@ -37,13 +218,40 @@ func GetParams[T any](w http.ResponseWriter, req bunrouter.Request) *T {
 func GetBody[T any](w http.ResponseWriter, req bunrouter.Request) *T {
 	data := new(T)
 
-	if err := json.NewDecoder(req.Body).Decode(data); err != nil {
+	if err := Decode(req.Request, data); err != nil {
 		Error(w, err, http.StatusBadRequest)
 	}
 
 	return data
 }
 
+// Decode reads the body of req into v, as protobuf when the request says so
+// and v is a proto message, or as JSON.
+func Decode(req *http.Request, v any) error {
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	return Unmarshal(req.Header.Get("Content-Type"), data, v)
+}
+
+func Unmarshal(contentType string, data []byte, v any) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return json.Unmarshal(data, v)
+	}
+
+	switch mediaType {
+	case ContentTypeProtobuf, "application/protobuf":
+		return proto.Unmarshal(data, msg)
+	default:
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, msg)
+	}
+}
+
 func GetFormData[T any](w http.ResponseWriter, req bunrouter.Request) *T {
 	//data, err := json.Marshal(req.Form.Encode())
 
@@ -53,6 +261,10 @@ func GetFormData[T any](w http.ResponseWriter, req bunrouter.Request) *T {
 func Error(w http.ResponseWriter, err error, code int) {
 	w.WriteHeader(code)
 
-	log.Printf("%+v\n", err)
+	if code >= http.StatusInternalServerError {
+		slog.Error("http error", "status", code, "error", err)
+	} else {
+		slog.Info("http error", "status", code, "error", err)
+	}
 	_, _ = w.Write([]byte(err.Error()))
 }
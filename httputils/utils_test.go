@@ -0,0 +1,122 @@
+package httputils
+
+import (
+	"github.com/uptrace/bunrouter"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ContentTypeJSON},
+		{"*/*", ContentTypeJSON},
+		{"application/json", ContentTypeJSON},
+		{"application/x-protobuf", ContentTypeProtobuf},
+		{"application/protobuf", ContentTypeProtobuf},
+		{"application/json, application/x-protobuf", ContentTypeJSON},
+		{"application/json;q=0.5, application/x-protobuf", ContentTypeProtobuf},
+		{"application/x-protobuf;q=0.9, */*;q=0.1", ContentTypeProtobuf},
+		{"application/json;q=0, application/x-protobuf;q=0.1", ContentTypeProtobuf},
+		{"application/json;q=0, */*", ContentTypeProtobuf},
+		{"application/x-protobuf;q=0, */*", ContentTypeJSON},
+		{"application/*;q=0, application/x-protobuf", ContentTypeProtobuf},
+		{"application/x-protobuf;q=0", ContentTypeJSON},
+		{"application/x-protobuf;q=abc", ContentTypeJSON},
+		{"text/html", ContentTypeJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := Negotiate(tt.accept); got != tt.want {
+				t.Fatalf("Negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONNegotiation(t *testing.T) {
+	tests := []struct {
+		name       string
+		middleware bool
+		accept     string
+		want       string
+	}{
+		{"without middleware", false, ContentTypeProtobuf, ContentTypeJSON},
+		{"json", true, ContentTypeJSON, ContentTypeJSON},
+		{"protobuf", true, ContentTypeProtobuf, ContentTypeProtobuf},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r *bunrouter.Router
+			if tt.middleware {
+				r = bunrouter.New(bunrouter.Use(NegotiateMiddleware))
+			} else {
+				r = bunrouter.New()
+			}
+
+			r.GET("/", func(w http.ResponseWriter, req bunrouter.Request) error {
+				return Response(w, func() (*wrapperspb.StringValue, error) {
+					return wrapperspb.String("ok"), nil
+				})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Content-Type"); got != tt.want {
+				t.Fatalf("Content-Type = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// wrappedWriter stands for a writer added by a middleware running after
+// NegotiateMiddleware.
+type wrappedWriter struct {
+	http.ResponseWriter
+}
+
+func (w *wrappedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestNegotiatedWriter(t *testing.T) {
+	r := bunrouter.New(bunrouter.Use(NegotiateMiddleware))
+
+	var flushed, hijackErr bool
+	r.GET("/", func(w http.ResponseWriter, req bunrouter.Request) error {
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+			flushed = true
+		}
+		if hijacker, ok := w.(http.Hijacker); ok {
+			_, _, err := hijacker.Hijack()
+			hijackErr = err != nil
+		}
+
+		return JSON(&wrappedWriter{w}, wrapperspb.String("ok"), nil)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", ContentTypeProtobuf)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if !flushed || !w.Flushed {
+		t.Fatalf("expected Flush to reach the recorder")
+	}
+	if !hijackErr {
+		t.Fatalf("expected Hijack to report the recorder does not support it")
+	}
+	if got := w.Header().Get("Content-Type"); got != ContentTypeProtobuf {
+		t.Fatalf("Content-Type = %q, want the negotiated type through a wrapping writer", got)
+	}
+}